@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,8 +21,13 @@ import (
 
 func main() {
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
+	validateOnly := flag.Bool("validate", false, "Validate the configuration file and exit")
 	flag.Parse()
 
+	if *validateOnly {
+		os.Exit(validateConfig(*configPath))
+	}
+
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	log.Printf("LlamaWrapper Gateway starting...")
 
@@ -27,6 +35,12 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if errs := config.Validate(cfg); len(errs) > 0 {
+		for _, e := range errs {
+			log.Printf("Config error: %s", e.Error())
+		}
+		log.Fatalf("Config %s has %d error(s)", *configPath, len(errs))
+	}
 
 	log.Printf("Loaded %d model(s), max concurrent: %d", len(cfg.Models), cfg.MaxLoadedModels)
 	for _, m := range cfg.Models {
@@ -49,20 +63,44 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	go manager.HealthCheck(ctx, cfg.HealthCheckSec)
+	go manager.IdleUnloader(ctx)
+	go manager.Autoscale(ctx)
+	go manager.WatchModelFiles(ctx)
 
 	handler := api.NewHandler(manager)
-	mux := http.NewServeMux()
-	handler.RegisterRoutes(mux)
+	go handler.SweepAsyncResults(ctx)
+	mux, adminMux := newMuxes(handler, cfg)
+
+	// Build middleware chain: Recover -> CORS -> Logging -> Gzip -> RequestID -> RealIP
+	chain := func(mux *http.ServeMux) http.Handler {
+		var h http.Handler = mux
+		h = middleware.RealIP(func(ip net.IP) bool {
+			return manager.GetConfig().IsTrustedProxy(ip)
+		})(h)
+		h = middleware.RequestID(h)
+		h = reloadable(manager, func(c *config.Config) func(http.Handler) http.Handler {
+			return middleware.Gzip(c.Compression)
+		}, h)
+		h = middleware.Logging(h)
+		h = reloadable(manager, func(c *config.Config) func(http.Handler) http.Handler {
+			return middleware.CORS(c.CORS)
+		}, h)
+		h = middleware.Recover(h)
+		return h
+	}
 
-	// Build middleware chain: CORS -> Logging -> RequestID
-	var h http.Handler = mux
-	h = middleware.RequestID(h)
-	h = middleware.Logging(h)
-	h = corsMiddleware(h)
+	var adminServer *http.Server
+	if adminMux != nil {
+		adminServer = &http.Server{
+			Addr:        cfg.AdminListenAddr,
+			Handler:     chain(adminMux),
+			IdleTimeout: 120 * time.Second,
+		}
+	}
 
 	server := &http.Server{
 		Addr:         cfg.ListenAddr,
-		Handler:      h,
+		Handler:      chain(mux),
 		ReadTimeout:  0,
 		WriteTimeout: 0,
 		IdleTimeout:  120 * time.Second,
@@ -77,17 +115,29 @@ func main() {
 			case syscall.SIGHUP:
 				log.Printf("Received SIGHUP — reloading configuration...")
 				newCfg, err := config.Load(*configPath)
+				if err == nil {
+					if errs := config.Validate(newCfg); len(errs) > 0 {
+						for _, e := range errs {
+							log.Printf("Config error: %s", e.Error())
+						}
+						err = fmt.Errorf("%d validation error(s)", len(errs))
+					}
+				}
 				if err != nil {
 					log.Printf("Config reload failed: %v", err)
 				} else {
-					manager.UpdateConfig(newCfg)
-					log.Printf("Configuration reloaded successfully")
+					summary := manager.UpdateConfig(newCfg)
+					log.Printf("Configuration reloaded successfully (removed: %v, changed: %v, unchanged: %v)",
+						summary.Removed, summary.Changed, summary.Unchanged)
 				}
 			case syscall.SIGINT, syscall.SIGTERM:
 				log.Printf("Shutting down gracefully...")
 				manager.Shutdown()
 				shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
 				defer shutdownCancel()
+				if adminServer != nil {
+					adminServer.Shutdown(shutdownCtx)
+				}
 				server.Shutdown(shutdownCtx)
 				return
 			}
@@ -101,22 +151,78 @@ func main() {
 	log.Printf("  GET  %s/v1/models", cfg.ListenAddr)
 	log.Printf("  GET  %s/health", cfg.ListenAddr)
 
+	if adminServer != nil {
+		log.Printf("Admin endpoints listening on %s", cfg.AdminListenAddr)
+		go func() {
+			if err := adminServer.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+	}
+
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
 }
 
-func corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-Id")
+// newMuxes registers the API routes on the public mux. Admin endpoints move
+// to their own mux when admin_listen_addr is configured, so the public port
+// only serves the API; otherwise admin is nil and they share the public mux.
+func newMuxes(handler *api.Handler, cfg *config.Config) (public, admin *http.ServeMux) {
+	public = http.NewServeMux()
+	handler.RegisterRoutes(public)
+	if cfg.AdminListenAddr == "" {
+		handler.RegisterAdminRoutes(public)
+		return public, nil
+	}
+	admin = http.NewServeMux()
+	handler.RegisterAdminRoutes(admin)
+	return public, admin
+}
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
+// reloadable applies the middleware mw builds from the running config,
+// rebuilding it when a SIGHUP reload swaps in a new config.
+func reloadable(manager *process.Manager, mw func(*config.Config) func(http.Handler) http.Handler, next http.Handler) http.Handler {
+	var mu sync.Mutex
+	var builtFor *config.Config
+	var h http.Handler
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := manager.GetConfig()
+		mu.Lock()
+		if cfg != builtFor {
+			builtFor, h = cfg, mw(cfg)(next)
 		}
-
-		next.ServeHTTP(w, r)
+		cur := h
+		mu.Unlock()
+		cur.ServeHTTP(w, r)
 	})
 }
+
+// validateConfig prints every problem found in the config file and returns
+// the process exit code: 0 if it is valid, 1 otherwise.
+func validateConfig(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+		return 1
+	}
+
+	code := 0
+	for _, e := range config.ValidateYAML(data) {
+		level := "error"
+		if e.Warning {
+			level = "warning"
+		} else {
+			code = 1
+		}
+		if e.Line > 0 {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s: %s\n", path, e.Line, level, e.Error())
+		} else {
+			fmt.Fprintf(os.Stderr, "%s: %s: %s\n", path, level, e.Error())
+		}
+	}
+	if code == 0 {
+		fmt.Printf("%s: configuration is valid\n", path)
+	}
+	return code
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/llamawrapper/gateway/internal/api"
+	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/process"
+)
+
+func TestNewMuxesAdminListenAddr(t *testing.T) {
+	tests := []struct {
+		name            string
+		adminListenAddr string
+		wantPublicAdmin bool // /admin/* served on the public mux
+	}{
+		{"shared listener", "", true},
+		{"separate admin listener", "127.0.0.1:8001", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			yaml := "llama_server_path: /bin/true\n" +
+				"models:\n  - {name: a, external_url: \"http://127.0.0.1:9\"}\n"
+			if tt.adminListenAddr != "" {
+				yaml += "admin_listen_addr: " + tt.adminListenAddr + "\n"
+			}
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			public, admin := newMuxes(api.NewHandler(process.NewManager(cfg)), cfg)
+
+			if code := serve(public, "/v1/models"); code != http.StatusOK {
+				t.Errorf("public /v1/models: status %d, want 200", code)
+			}
+			for _, p := range []string{"/admin/requests", "/admin/drain", "/admin/reload-model"} {
+				code := serve(public, p)
+				if tt.wantPublicAdmin && code == http.StatusNotFound {
+					t.Errorf("public %s: status 404, want it served", p)
+				}
+				if !tt.wantPublicAdmin && code != http.StatusNotFound {
+					t.Errorf("public %s: status %d, want 404", p, code)
+				}
+			}
+
+			if tt.wantPublicAdmin {
+				if admin != nil {
+					t.Error("admin mux built without admin_listen_addr")
+				}
+				return
+			}
+			if admin == nil {
+				t.Fatal("no admin mux with admin_listen_addr set")
+			}
+			if code := serve(admin, "/admin/requests"); code == http.StatusNotFound {
+				t.Error("admin /admin/requests: status 404, want it served")
+			}
+			if code := serve(admin, "/v1/models"); code != http.StatusNotFound {
+				t.Errorf("admin /v1/models: status %d, want 404", code)
+			}
+		})
+	}
+}
+
+func serve(h http.Handler, path string) int {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
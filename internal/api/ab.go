@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// abVariantStats accumulates results for one variant of an A/B test.
+type abVariantStats struct {
+	Model    string
+	Requests int64
+	Errors   int64 // 5xx responses
+	Latency  time.Duration
+}
+
+// abStats collects per-variant results of the configured A/B tests since the
+// gateway started.
+type abStats struct {
+	mu    sync.Mutex
+	tests map[string]map[string]*abVariantStats // test -> "a"/"b"
+}
+
+func newABStats() *abStats {
+	return &abStats{tests: make(map[string]map[string]*abVariantStats)}
+}
+
+func (s *abStats) record(test, variant, model string, d time.Duration, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	variants, ok := s.tests[test]
+	if !ok {
+		variants = make(map[string]*abVariantStats)
+		s.tests[test] = variants
+	}
+	v, ok := variants[variant]
+	if !ok {
+		v = &abVariantStats{Model: model}
+		variants[variant] = v
+	}
+	v.Requests++
+	v.Latency += d
+	if status >= 500 {
+		v.Errors++
+	}
+}
+
+// abWriter records the status of a response for abStats.
+type abWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *abWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *abWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type abVariantResult struct {
+	Model         string  `json:"model"`
+	Requests      int64   `json:"requests"`
+	Errors        int64   `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"`
+	MeanLatencyMs float64 `json:"mean_latency_ms"`
+}
+
+type abTestResult struct {
+	Name     string                     `json:"name"`
+	SplitPct float64                    `json:"split_pct"`
+	Variants map[string]abVariantResult `json:"variants"`
+	// Relative change of variant b against a; omitted until both have traffic
+	LatencyChangePct *float64 `json:"latency_change_pct,omitempty"`
+	ErrorRateChange  *float64 `json:"error_rate_change,omitempty"`
+}
+
+// handleABResults serves GET /admin/ab-results.
+func (h *Handler) handleABResults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var results []abTestResult
+	h.ab.mu.Lock()
+	for _, t := range h.manager.GetConfig().ABTests {
+		res := abTestResult{Name: t.Name, SplitPct: t.SplitPct, Variants: make(map[string]abVariantResult)}
+		for variant, v := range h.ab.tests[t.Name] {
+			vr := abVariantResult{Model: v.Model, Requests: v.Requests, Errors: v.Errors}
+			if v.Requests > 0 {
+				vr.ErrorRate = float64(v.Errors) / float64(v.Requests)
+				vr.MeanLatencyMs = float64(v.Latency.Microseconds()) / 1000 / float64(v.Requests)
+			}
+			res.Variants[variant] = vr
+		}
+		a, okA := res.Variants["a"]
+		b, okB := res.Variants["b"]
+		if okA && okB && a.Requests > 0 && b.Requests > 0 {
+			errChange := b.ErrorRate - a.ErrorRate
+			res.ErrorRateChange = &errChange
+			if a.MeanLatencyMs > 0 {
+				latChange := (b.MeanLatencyMs - a.MeanLatencyMs) / a.MeanLatencyMs * 100
+				res.LatencyChangePct = &latChange
+			}
+		}
+		results = append(results, res)
+	}
+	h.ab.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tests": results})
+}
@@ -0,0 +1,384 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/middleware"
+	"github.com/llamawrapper/gateway/internal/process"
+)
+
+// requireTrusted rejects callers outside trusted_subnets; the admin
+// endpoints are unavailable when none are configured.
+func (h *Handler) requireTrusted(w http.ResponseWriter, r *http.Request) bool {
+	if ip := middleware.ClientIP(r); !h.manager.GetConfig().IsTrusted(ip) {
+		log.Printf("[api] Refusing %s %s from untrusted client %s", r.Method, r.URL.Path, ip)
+		writeError(w, http.StatusForbidden, "admin endpoints are limited to trusted_subnets")
+		return false
+	}
+	return true
+}
+
+// adminModel returns the model an admin request names, or writes an error
+// and returns "". Groups are refused, since the operation would land on
+// whichever member happened to be next.
+func (h *Handler) adminModel(w http.ResponseWriter, requested string) string {
+	cfg := h.manager.GetConfig()
+	if members := cfg.GroupModels(requested); members != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%q is a model group; name one of its models (%s)",
+			requested, strings.Join(members, ", ")))
+		return ""
+	}
+	name := cfg.LookupModel(requested)
+	if name == "" {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("model %q not found", requested))
+	}
+	return name
+}
+
+// handleDrain serves POST /admin/drain {"model": "..."}: the model stops
+// taking new requests and unloads once its in-flight requests finish.
+func (h *Handler) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	name := h.adminModel(w, body.Model)
+	if name == "" {
+		return
+	}
+	if err := h.manager.DrainModel(name); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	log.Printf("[api] Drain of %s requested by %s", name, middleware.ClientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "draining": true})
+}
+
+// handleRollingRestart serves POST /admin/rolling-restart {"model": "..."}:
+// each instance of the loaded model is replaced by a fresh one, one at a
+// time, so requests keep being served. It answers once all are replaced.
+func (h *Handler) handleRollingRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	name := h.adminModel(w, body.Model)
+	if name == "" {
+		return
+	}
+	if !slices.Contains(h.manager.ListLoaded(), name) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("model %q is not loaded", name))
+		return
+	}
+	log.Printf("[api] Rolling restart of %s requested by %s", name, middleware.ClientIP(r))
+
+	// Finish even if the caller disconnects; stopping halfway leaves a
+	// mix of old and new instances
+	if err := h.manager.RollingRestart(context.Background(), name); err != nil {
+		log.Printf("[api] Rolling restart of %s failed: %v", name, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "restarted": true})
+}
+
+// handleHotSwap serves POST /admin/hot-swap {"model": "...", "model_path":
+// "..."}: the model is pointed at a new GGUF file and its loaded instances
+// are replaced one at a time. The new path lasts until the next reload.
+func (h *Handler) handleHotSwap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Model     string `json:"model"`
+		ModelPath string `json:"model_path"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model == "" || body.ModelPath == "" {
+		writeError(w, http.StatusBadRequest, "model and model_path are required")
+		return
+	}
+	name := h.adminModel(w, body.Model)
+	if name == "" {
+		return
+	}
+	log.Printf("[api] Hot-swap of %s to %s requested by %s", name, body.ModelPath, middleware.ClientIP(r))
+
+	// As with rolling restarts, a disconnecting caller must not leave the
+	// swap half done
+	if err := h.manager.HotSwap(context.Background(), name, body.ModelPath); err != nil {
+		log.Printf("[api] Hot-swap of %s failed: %v", name, err)
+		if errors.Is(err, fs.ErrNotExist) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "model_path": body.ModelPath, "swapped": true})
+}
+
+// handleReloadModel serves POST /admin/reload-model {"model": "..."}: the
+// loaded model's instances are restarted from its current file and settings,
+// each new one taking over before the old one is drained.
+func (h *Handler) handleReloadModel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Model == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	name := h.adminModel(w, body.Model)
+	if name == "" {
+		return
+	}
+	if !slices.Contains(h.manager.ListLoaded(), name) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("model %q is not loaded", name))
+		return
+	}
+	log.Printf("[api] Reload of %s requested by %s", name, middleware.ClientIP(r))
+
+	if err := h.manager.ReloadModel(context.Background(), name); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "reloaded": true})
+}
+
+// defaultLogLines is how many lines /admin/logs returns without ?n=.
+const defaultLogLines = 100
+
+// handleLogs serves GET /admin/logs?model=X&instance=N&n=N: the most recent
+// llama-server output of a loaded model, from every instance unless one is
+// given.
+func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Get("model") == "" {
+		writeError(w, http.StatusBadRequest, "model is required")
+		return
+	}
+	name := h.adminModel(w, q.Get("model"))
+	if name == "" {
+		return
+	}
+	instance, n := -1, defaultLogLines
+	if v := q.Get("instance"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i < 0 {
+			writeError(w, http.StatusBadRequest, "instance must be a non-negative integer")
+			return
+		}
+		instance = i
+	}
+	if v := q.Get("n"); v != "" {
+		i, err := strconv.Atoi(v)
+		if err != nil || i <= 0 {
+			writeError(w, http.StatusBadRequest, "n must be a positive integer")
+			return
+		}
+		n = i
+	}
+
+	lines := h.manager.GetBackendLogs(name, instance, n)
+	if lines == nil {
+		lines = []process.LogLine{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "lines": lines})
+}
+
+// handleProcessStats serves GET /admin/process-stats: CPU and RSS of every
+// running llama-server process. CPU is averaged since the previous call.
+func (h *Handler) handleProcessStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	stats := h.manager.GetProcessStats()
+	if stats == nil {
+		stats = []process.ProcessStats{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"processes": stats})
+}
+
+// handleMaintenance serves POST /admin/maintenance {"enabled": true,
+// "message": "..."}. The setting lasts until changed again or until a reload
+// changes the maintenance section of the config.
+func (h *Handler) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Enabled *bool  `json:"enabled"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeError(w, http.StatusBadRequest, "enabled is required")
+		return
+	}
+	log.Printf("[api] Maintenance mode set to %v by %s", *body.Enabled, middleware.ClientIP(r))
+	h.manager.SetMaintenance(*body.Enabled, body.Message)
+
+	on, message := h.manager.Maintenance()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"enabled": on, "message": message})
+}
+
+// handleListQueue serves GET /admin/queue.
+func (h *Handler) handleListQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"queue": h.manager.ListQueue()})
+}
+
+// handleFlushQueue serves POST /admin/queue/flush {"model": "..."}. Without
+// a model, the whole queue is flushed.
+func (h *Handler) handleFlushQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		Model string `json:"model"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON in request body")
+			return
+		}
+	}
+	name := body.Model
+	if name != "" {
+		if name = h.adminModel(w, body.Model); name == "" {
+			return
+		}
+	}
+
+	flushed := h.manager.FlushQueue(name)
+	scope := name
+	if scope == "" {
+		scope = "all models"
+	}
+	log.Printf("[api] Queue flush for %s by %s: %d request(s) removed", scope, middleware.ClientIP(r), flushed)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": name, "flushed": flushed})
+}
+
+// maxConfigBytes caps the config files accepted by /admin/config/validate.
+const maxConfigBytes = 1 << 20
+
+// handleValidateConfig checks the YAML config in the request body the way a
+// reload would, without touching the running config or the file on disk.
+func (h *Handler) handleValidateConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBytes))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("config exceeds %d bytes", maxConfigBytes))
+		return
+	}
+
+	valid := true
+	problems := config.ValidateYAML(data)
+	for _, p := range problems {
+		if !p.Warning {
+			valid = false
+		}
+	}
+	if problems == nil {
+		problems = []config.ValidationError{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": valid, "errors": problems})
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/process"
+)
+
+// testHandler returns a Handler over a config loaded from yaml.
+func testHandler(t *testing.T, yaml string) *Handler {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewHandler(process.NewManager(cfg))
+}
+
+func TestAdminModel(t *testing.T) {
+	h := testHandler(t, `
+llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [fast]}
+  - {name: b, external_url: "http://127.0.0.1:9"}
+groups:
+  - {name: pool, models: [a, b]}
+`)
+	tests := []struct {
+		requested  string
+		want       string
+		wantStatus int
+	}{
+		{requested: "a", want: "a", wantStatus: http.StatusOK},
+		{requested: "fast", want: "a", wantStatus: http.StatusOK},
+		{requested: "pool", wantStatus: http.StatusBadRequest},
+		{requested: "missing", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.requested, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if got := h.adminModel(rec, tt.requested); got != tt.want {
+				t.Errorf("adminModel(%q) = %q, want %q", tt.requested, got, tt.want)
+			}
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+	// Refused lookups must not disturb the group's rotation
+	if got := h.manager.GetConfig().ResolveAlias("pool"); got != "a" {
+		t.Errorf("first pick after admin lookups = %q, want a", got)
+	}
+}
+
+func TestHandleValidateConfig(t *testing.T) {
+	h := testHandler(t, `
+llama_server_path: /bin/true
+trusted_subnets: [192.0.2.0/24]
+models:
+  - {name: a, external_url: "http://127.0.0.1:9"}
+`)
+	tests := []struct {
+		name       string
+		body       string
+		wantValid  bool
+		wantFields []string
+	}{
+		{name: "valid", wantValid: true,
+			body: "llama_server_path: /bin/true\nmodels:\n  - {name: b, external_url: \"http://127.0.0.1:9\"}\n"},
+		{name: "warning only", wantValid: true, wantFields: []string{"models[0].aliases[0]"},
+			body: "llama_server_path: /bin/true\nmodels:\n  - {name: b, aliases: [b], external_url: \"http://127.0.0.1:9\"}\n"},
+		{name: "invalid", wantValid: false, wantFields: []string{"llama_server_path"},
+			body: "models: []\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.handleValidateConfig(rec, httptest.NewRequest(http.MethodPost, "/admin/config/validate", strings.NewReader(tt.body)))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Valid  bool                     `json:"valid"`
+				Errors []config.ValidationError `json:"errors"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Valid != tt.wantValid {
+				t.Errorf("valid = %v, want %v (errors %+v)", resp.Valid, tt.wantValid, resp.Errors)
+			}
+			var fields []string
+			for _, e := range resp.Errors {
+				fields = append(fields, e.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("error fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+
+	// The running config is left alone
+	if got := h.manager.GetConfig().LookupModel("a"); got != "a" {
+		t.Errorf("running config lost model a after validation (lookup = %q)", got)
+	}
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// asyncResultTTL is how long a finished asynchronous response stays
+	// available at its poll URL.
+	asyncResultTTL = 10 * time.Minute
+	// asyncSweepInterval is how often expired results are dropped.
+	asyncSweepInterval = time.Minute
+)
+
+// asyncResult collects the response to a queued request that was answered
+// with 202 Accepted, until the client fetches it from its poll URL. It is an
+// http.ResponseWriter and http.Flusher, so the normal proxy path writes into
+// it unchanged.
+type asyncResult struct {
+	ID      string
+	Model   string
+	Stream  bool
+	Created time.Time
+
+	header   http.Header
+	mu       sync.Mutex
+	sent     http.Header // header as of WriteHeader
+	status   int         // 0 until the response starts
+	body     []byte
+	done     bool
+	finished time.Time
+	changed  chan struct{} // closed and replaced on every update
+}
+
+// Header returns the header map to be sent with WriteHeader.
+func (r *asyncResult) Header() http.Header {
+	return r.header
+}
+
+func (r *asyncResult) WriteHeader(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status != 0 {
+		return
+	}
+	r.status = status
+	r.sent = r.header.Clone()
+	r.notifyLocked()
+}
+
+func (r *asyncResult) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	if r.status == 0 {
+		r.mu.Unlock()
+		r.WriteHeader(http.StatusOK)
+		r.mu.Lock()
+	}
+	r.body = append(r.body, p...)
+	r.notifyLocked()
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+// Flush is a no-op: every Write is immediately visible to readers.
+func (r *asyncResult) Flush() {}
+
+// finish marks the response complete.
+func (r *asyncResult) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.done = true
+	r.finished = time.Now()
+	r.notifyLocked()
+}
+
+func (r *asyncResult) notifyLocked() {
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *asyncResult) finishedAt() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.finished, r.done
+}
+
+// read returns the response status and header (status 0 while nothing has
+// been written), the body from offset on, whether the response is complete,
+// and a channel that is closed on the next update.
+func (r *asyncResult) read(offset int) (status int, header http.Header, chunk []byte, done bool, changed <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if offset < len(r.body) {
+		chunk = r.body[offset:len(r.body):len(r.body)]
+	}
+	return r.status, r.sent, chunk, r.done, r.changed
+}
+
+// asyncResults holds the responses to asynchronous queued requests, by queue
+// ID, until they expire.
+type asyncResults struct {
+	mu      sync.Mutex
+	results map[string]*asyncResult
+}
+
+func newAsyncResults() *asyncResults {
+	return &asyncResults{results: make(map[string]*asyncResult)}
+}
+
+// add registers an empty result for a request about to be queued. At most
+// limit results are held (0 is unlimited): when full, the oldest finished
+// result is dropped to make room, and if every result is still pending, add
+// fails.
+func (s *asyncResults) add(model string, stream bool, limit int) (*asyncResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limit > 0 && len(s.results) >= limit {
+		var oldestID string
+		var oldest time.Time
+		for id, r := range s.results {
+			if fin, ok := r.finishedAt(); ok && (oldestID == "" || fin.Before(oldest)) {
+				oldestID, oldest = id, fin
+			}
+		}
+		if oldestID == "" {
+			return nil, false
+		}
+		delete(s.results, oldestID)
+	}
+
+	b := make([]byte, 8)
+	rand.Read(b)
+	res := &asyncResult{
+		ID:      fmt.Sprintf("q_%x", b),
+		Model:   model,
+		Stream:  stream,
+		Created: time.Now(),
+		header:  make(http.Header),
+		changed: make(chan struct{}),
+	}
+	s.results[res.ID] = res
+	return res, true
+}
+
+// get returns the result registered under id.
+func (s *asyncResults) get(id string) (*asyncResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res, ok := s.results[id]
+	return res, ok
+}
+
+// sweep drops results that finished more than asyncResultTTL before now and
+// returns how many it dropped.
+func (s *asyncResults) sweep(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dropped := 0
+	for id, r := range s.results {
+		if fin, ok := r.finishedAt(); ok && now.Sub(fin) > asyncResultTTL {
+			delete(s.results, id)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// SweepAsyncResults periodically drops queued responses that have not been
+// fetched within asyncResultTTL of finishing.
+func (h *Handler) SweepAsyncResults(ctx context.Context) {
+	ticker := time.NewTicker(asyncSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if n := h.async.sweep(now); n > 0 {
+				log.Printf("[queue] Dropped %d expired queued response(s)", n)
+			}
+		}
+	}
+}
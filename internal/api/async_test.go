@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAsyncResultsLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		pending  int // results still being served
+		finished int // results waiting to be fetched
+		wantAdd  bool
+	}{
+		{name: "room left", limit: 3, pending: 1, finished: 1, wantAdd: true},
+		{name: "full of pending", limit: 2, pending: 2, wantAdd: false},
+		{name: "full, finished one dropped", limit: 2, pending: 1, finished: 1, wantAdd: true},
+		{name: "unlimited", limit: 0, pending: 5, wantAdd: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newAsyncResults()
+			for i := 0; i < tt.pending; i++ {
+				s.add("m", false, 0)
+			}
+			for i := 0; i < tt.finished; i++ {
+				res, _ := s.add("m", false, 0)
+				res.finish()
+			}
+
+			res, ok := s.add("m", false, tt.limit)
+			if ok != tt.wantAdd {
+				t.Fatalf("add ok = %v, want %v", ok, tt.wantAdd)
+			}
+			if ok {
+				if _, found := s.get(res.ID); !found {
+					t.Errorf("added result %s not found", res.ID)
+				}
+			}
+			if tt.limit > 0 && len(s.results) > tt.limit {
+				t.Errorf("holding %d results, limit %d", len(s.results), tt.limit)
+			}
+		})
+	}
+}
+
+func TestAsyncResultsSweep(t *testing.T) {
+	s := newAsyncResults()
+	pending, _ := s.add("m", false, 0)
+	fresh, _ := s.add("m", false, 0)
+	fresh.finish()
+	expired, _ := s.add("m", false, 0)
+	expired.finish()
+	expired.finished = time.Now().Add(-asyncResultTTL - time.Second)
+
+	if n := s.sweep(time.Now()); n != 1 {
+		t.Errorf("sweep dropped %d results, want 1", n)
+	}
+	for _, tt := range []struct {
+		res  *asyncResult
+		want bool
+	}{{pending, true}, {fresh, true}, {expired, false}} {
+		if _, ok := s.get(tt.res.ID); ok != tt.want {
+			t.Errorf("result %s present = %v, want %v", tt.res.ID, ok, tt.want)
+		}
+	}
+}
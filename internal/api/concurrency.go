@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// concurrencyLimiter counts in-flight requests per client and per model.
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	clients map[string]int
+	models  map[string]int
+	freed   chan struct{} // closed and replaced whenever a slot is released
+}
+
+func newConcurrencyLimiter() *concurrencyLimiter {
+	return &concurrencyLimiter{
+		clients: make(map[string]int),
+		models:  make(map[string]int),
+		freed:   make(chan struct{}),
+	}
+}
+
+// acquire takes a slot for the client and the model, or returns a message
+// describing the limit that was hit. Limits of 0 are unlimited. The returned
+// release function must be called when the request finishes.
+func (cl *concurrencyLimiter) acquire(client, model string, clientLimit, modelLimit int) (func(), string) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	return cl.acquireLocked(client, model, clientLimit, modelLimit)
+}
+
+// wait is like acquire, but while a limit is hit it waits for a slot to free
+// up until ctx is done, and only then returns the message.
+func (cl *concurrencyLimiter) wait(ctx context.Context, client, model string, clientLimit, modelLimit int) (func(), string) {
+	for {
+		cl.mu.Lock()
+		release, msg := cl.acquireLocked(client, model, clientLimit, modelLimit)
+		freed := cl.freed
+		cl.mu.Unlock()
+		if msg == "" {
+			return release, ""
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, msg
+		}
+	}
+}
+
+func (cl *concurrencyLimiter) acquireLocked(client, model string, clientLimit, modelLimit int) (func(), string) {
+	if clientLimit > 0 && cl.clients[client] >= clientLimit {
+		return nil, fmt.Sprintf("too many concurrent requests from this client (limit %d)", clientLimit)
+	}
+	if modelLimit > 0 && cl.models[model] >= modelLimit {
+		return nil, fmt.Sprintf("too many concurrent requests for model %q (limit %d)", model, modelLimit)
+	}
+	cl.clients[client]++
+	cl.models[model]++
+
+	return func() {
+		cl.mu.Lock()
+		defer cl.mu.Unlock()
+		for _, m := range []struct {
+			counts map[string]int
+			key    string
+		}{{cl.clients, client}, {cl.models, model}} {
+			if m.counts[m.key]--; m.counts[m.key] <= 0 {
+				delete(m.counts, m.key)
+			}
+		}
+		close(cl.freed)
+		cl.freed = make(chan struct{})
+	}, ""
+}
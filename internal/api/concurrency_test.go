@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiterWait(t *testing.T) {
+	cl := newConcurrencyLimiter()
+	release, msg := cl.acquire("c", "m", 1, 0)
+	if msg != "" {
+		t.Fatal(msg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, msg := cl.wait(ctx, "c", "m", 1, 0); msg == "" {
+		t.Fatal("wait took a slot that was still held")
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		release()
+	}()
+	release2, msg := cl.wait(context.Background(), "c", "m", 1, 0)
+	if msg != "" {
+		t.Fatalf("wait after release: %s", msg)
+	}
+	release2()
+}
+
+// TestConcurrencyLimit holds max_concurrent requests open on a blocked
+// backend and sends one more.
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 2
+	tests := []struct {
+		name  string
+		queue string
+	}{
+		{name: "rejected"},
+		{name: "queued", queue: "queue: {enabled: true, timeout_sec: 5}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrived := make(chan struct{}, limit+1)
+			unblock := make(chan struct{})
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				arrived <- struct{}{}
+				<-unblock
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[]}`))
+			}))
+			defer backend.Close()
+			defer func() {
+				select {
+				case <-unblock:
+				default:
+					close(unblock)
+				}
+			}()
+
+			h := testHandler(t, "llama_server_path: /bin/true\n"+tt.queue+
+				"models:\n  - {name: m, external_url: \""+backend.URL+"\", max_concurrent: 2}\n")
+			send := func() *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+					strings.NewReader(`{"model":"m","messages":[{"role":"user","content":"hi"}]}`))
+				rec := httptest.NewRecorder()
+				h.handleChatCompletions(rec, req)
+				return rec
+			}
+
+			held := make(chan *httptest.ResponseRecorder, limit)
+			for i := 0; i < limit; i++ {
+				go func() { held <- send() }()
+				<-arrived
+			}
+
+			extra := make(chan *httptest.ResponseRecorder, 1)
+			go func() { extra <- send() }()
+
+			if tt.queue == "" {
+				rec := <-extra
+				if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "concurrency_limit") {
+					t.Errorf("request %d: %d %s, want 429 concurrency_limit", limit+1, rec.Code, rec.Body)
+				}
+				close(unblock)
+			} else {
+				select {
+				case rec := <-extra:
+					t.Fatalf("request %d answered while the slots were held: %d %s", limit+1, rec.Code, rec.Body)
+				case <-time.After(100 * time.Millisecond):
+				}
+				close(unblock)
+				if rec := <-extra; rec.Code != http.StatusOK {
+					t.Errorf("queued request: %d %s, want 200 once a slot freed", rec.Code, rec.Body)
+				}
+			}
+			for i := 0; i < limit; i++ {
+				if rec := <-held; rec.Code != http.StatusOK {
+					t.Errorf("held request: %d %s, want 200", rec.Code, rec.Body)
+				}
+			}
+		})
+	}
+}
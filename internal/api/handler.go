@@ -1,49 +1,102 @@
 package api
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/middleware"
 	"github.com/llamawrapper/gateway/internal/process"
 )
 
 type Handler struct {
-	manager *process.Manager
+	manager     *process.Manager
+	limiter     *rateLimiter
+	concurrency *concurrencyLimiter
+	latency     *latencyTracker
+	inflight    *inflightRegistry
+	ab          *abStats
+	async       *asyncResults
 }
 
 func NewHandler(manager *process.Manager) *Handler {
-	return &Handler{manager: manager}
+	return &Handler{
+		manager:     manager,
+		limiter:     newRateLimiter(),
+		concurrency: newConcurrencyLimiter(),
+		latency:     newLatencyTracker(),
+		inflight:    newInflightRegistry(),
+		ab:          newABStats(),
+		async:       newAsyncResults(),
+	}
 }
 
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/v1/chat/completions", h.handleChatCompletions)
 	mux.HandleFunc("/v1/completions", h.handleCompletions)
 	mux.HandleFunc("/v1/embeddings", h.handleEmbeddings)
+	mux.HandleFunc("/v1/tokenize", h.handleTokenize)
+	mux.HandleFunc("/v1/detokenize", h.handleDetokenize)
 	mux.HandleFunc("/v1/models", h.handleModels)
+	mux.HandleFunc("/v1/models/", h.handleModel)
+	mux.HandleFunc("/v1/queue/", h.handleQueuePoll)
 	mux.HandleFunc("/health", h.handleHealth)
 }
 
+// RegisterAdminRoutes adds the /admin endpoints, on the public mux or on a
+// separate one served at admin_listen_addr.
+func (h *Handler) RegisterAdminRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/requests", h.handleListRequests)
+	mux.HandleFunc("/admin/requests/cancel", h.handleCancelRequest)
+	mux.HandleFunc("/admin/drain", h.handleDrain)
+	mux.HandleFunc("/admin/rolling-restart", h.handleRollingRestart)
+	mux.HandleFunc("/admin/hot-swap", h.handleHotSwap)
+	mux.HandleFunc("/admin/reload-model", h.handleReloadModel)
+	mux.HandleFunc("/admin/logs", h.handleLogs)
+	mux.HandleFunc("/admin/process-stats", h.handleProcessStats)
+	mux.HandleFunc("/admin/maintenance", h.handleMaintenance)
+	mux.HandleFunc("/admin/ab-results", h.handleABResults)
+	mux.HandleFunc("/admin/queue", h.handleListQueue)
+	mux.HandleFunc("/admin/queue/flush", h.handleFlushQueue)
+	mux.HandleFunc("/admin/config/validate", h.handleValidateConfig)
+}
+
+// modelOverrideHeader lets trusted clients route a request to a different
+// model than the one in its body.
+const modelOverrideHeader = "X-Model-Override"
+
 type modelRequest struct {
 	Model string `json:"model"`
 }
 
+type usageResponse struct {
+	Usage struct {
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
 type openaiModelsResponse struct {
 	Object string            `json:"object"`
 	Data   []openaiModelItem `json:"data"`
 }
 
 type openaiModelItem struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	OwnedBy string `json:"owned_by"`
+	ID             string `json:"id"`
+	Object         string `json:"object"`
+	Created        int64  `json:"created"`
+	OwnedBy        string `json:"owned_by"`
+	SupportsVision bool   `json:"supports_vision,omitempty"`
+	Discovered     bool   `json:"discovered,omitempty"` // found by scanning a models directory
 }
 
 func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
@@ -57,36 +110,162 @@ func (h *Handler) handleModels(w http.ResponseWriter, r *http.Request) {
 
 	for _, m := range models {
 		data = append(data, openaiModelItem{
-			ID:      m.Name,
-			Object:  "model",
-			Created: time.Now().Unix(),
-			OwnedBy: "llamawrapper",
+			ID:             m.Name,
+			Object:         "model",
+			Created:        time.Now().Unix(),
+			OwnedBy:        "llamawrapper",
+			SupportsVision: m.SupportsVision,
+			Discovered:     m.Discovered,
 		})
 		for _, alias := range m.Aliases {
 			data = append(data, openaiModelItem{
-				ID:      alias,
-				Object:  "model",
-				Created: time.Now().Unix(),
-				OwnedBy: "llamawrapper",
+				ID:             alias,
+				Object:         "model",
+				Created:        time.Now().Unix(),
+				OwnedBy:        "llamawrapper",
+				SupportsVision: m.SupportsVision,
 			})
 		}
 	}
 
+	for _, g := range h.manager.GetConfig().Groups {
+		data = append(data, openaiModelItem{
+			ID:      g.Name,
+			Object:  "model",
+			Created: time.Now().Unix(),
+			OwnedBy: "llamawrapper",
+		})
+	}
+
 	resp := openaiModelsResponse{Object: "list", Data: data}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
+// modelDetail is the /v1/models/{id} response: the OpenAI model object plus
+// the gateway's settings and recent latency for the model.
+type modelDetail struct {
+	openaiModelItem
+	ContextLength   int      `json:"context_length"`
+	GPULayers       int      `json:"gpu_layers"`
+	Instances       int      `json:"instances"`
+	Aliases         []string `json:"aliases"`
+	Loaded          bool     `json:"loaded"`
+	AvgLatencyP50Ms float64  `json:"avg_latency_p50_ms"`
+	AvgLatencyP95Ms float64  `json:"avg_latency_p95_ms"`
+	// Download is the progress of the latest auto_download, if any
+	Download *process.DownloadStatus `json:"download,omitempty"`
+}
+
+// handleModel serves /v1/models/{id}. The id may be a model name, alias or
+// alias pattern match; group names get only the OpenAI fields.
+func (h *Handler) handleModel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/models/")
+	item := openaiModelItem{ID: id, Object: "model", Created: time.Now().Unix(), OwnedBy: "llamawrapper"}
+
+	cfg := h.manager.GetConfig()
+	for _, g := range cfg.Groups {
+		if g.Name == id {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(item)
+			return
+		}
+	}
+
+	name := cfg.LookupModel(id)
+	var m *config.ModelConfig
+	for i := range cfg.Models {
+		if cfg.Models[i].Name == name {
+			m = &cfg.Models[i]
+			break
+		}
+	}
+	if m == nil {
+		writeErrorCode(w, http.StatusNotFound, "model_not_found", fmt.Sprintf("model %q not found", id))
+		return
+	}
+
+	item.SupportsVision = m.SupportsVision
+	item.Discovered = m.Discovered && id == m.Name
+	instances := m.Instances
+	if instances < 1 {
+		instances = 1
+	}
+	detail := modelDetail{
+		openaiModelItem: item,
+		ContextLength:   m.ContextSize,
+		GPULayers:       m.GPULayers,
+		Instances:       instances,
+		Aliases:         append([]string{}, m.Aliases...),
+	}
+	for _, loaded := range h.manager.ListLoaded() {
+		if loaded == m.Name {
+			detail.Loaded = true
+			break
+		}
+	}
+	detail.AvgLatencyP50Ms, detail.AvgLatencyP95Ms = h.latency.percentiles(m.Name)
+	if st, ok := h.manager.GetDownloadStatus(m.Name); ok {
+		detail.Download = &st
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// handleHealth doubles as a readiness probe. With ?model=X it is ready only
+// when X has a ready backend (any member, for a group); otherwise it is
+// unready when every backend has failed, or when require_loaded_model is set
+// and nothing is loaded.
+func (h *Handler) handleHealth(w http.ResponseWriter, r *http.Request) {
 	loaded := h.manager.ListLoaded()
 	queueLen := h.manager.GetQueueLength()
-
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"status":        "ok",
 		"loaded_models": loaded,
 		"queue_depth":   queueLen,
-	})
+	}
+	if on, _ := h.manager.Maintenance(); on {
+		resp["maintenance"] = true
+	}
+	if draining := h.manager.ListDraining(); len(draining) > 0 {
+		resp["draining_models"] = draining
+	}
+
+	var ready bool
+	if requested := r.URL.Query().Get("model"); requested != "" {
+		if members := h.manager.GetConfig().GroupModels(requested); members != nil {
+			// A group can serve as long as any of its models can
+			for _, name := range members {
+				if h.manager.ModelReady(name) {
+					ready = true
+					break
+				}
+			}
+		} else {
+			modelName := h.manager.GetConfig().LookupModel(requested)
+			if modelName == "" {
+				modelName = resolveModelName(requested, h.manager.ListConfiguredModels())
+			}
+			ready = modelName != "" && h.manager.ModelReady(modelName)
+		}
+		resp["model"] = requested
+	} else {
+		ready = !h.manager.AllFailed() &&
+			(len(loaded) > 0 || !h.manager.GetConfig().RequireLoadedModel)
+	}
+	resp["ready"] = ready
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		resp["status"] = "unavailable"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *Handler) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
@@ -101,20 +280,51 @@ func (h *Handler) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
 	h.proxyToModel(w, r, "/v1/embeddings")
 }
 
+func (h *Handler) handleTokenize(w http.ResponseWriter, r *http.Request) {
+	h.proxyToModel(w, r, "/v1/tokenize")
+}
+
+func (h *Handler) handleDetokenize(w http.ResponseWriter, r *http.Request) {
+	h.proxyToModel(w, r, "/v1/detokenize")
+}
+
+// nativeEndpoints maps gateway routes to llama-server paths that have no /v1
+// form.
+var nativeEndpoints = map[string]string{
+	"/v1/tokenize":   "/tokenize",
+	"/v1/detokenize": "/detokenize",
+}
+
 func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint string) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	const maxBodySize = 10 * 1024 * 1024
-	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if on, message := h.manager.Maintenance(); on {
+		if message == "" {
+			message = "the gateway is in maintenance mode; try again later"
+		}
+		retry := h.manager.GetConfig().Maintenance.RetryAfterSec
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+		writeErrorCode(w, http.StatusServiceUnavailable, "maintenance", message)
+		return
+	}
+
+	// The model is only known after parsing, so read up to the largest limit
+	// any model allows and apply the model's own limit once it is resolved.
+	cfg := h.manager.GetConfig()
+	readLimit := cfg.MaxRequestBodyBytes
+	for _, m := range cfg.Models {
+		readLimit = max(readLimit, m.MaxRequestBodyBytes)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, readLimit+1))
 	if err != nil {
 		writeError(w, http.StatusBadRequest, "failed to read request body")
 		return
 	}
 	r.Body.Close()
-	if len(body) >= maxBodySize {
+	if int64(len(body)) > readLimit {
 		writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
 		return
 	}
@@ -130,7 +340,13 @@ func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint
 		return
 	}
 
-	cfg := h.manager.GetConfig()
+	var bodyMap map[string]interface{}
+	json.Unmarshal(body, &bodyMap)
+	if msg := validateRequest(endpoint, bodyMap); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	modelName := cfg.ResolveAlias(req.Model)
 	if modelName == "" {
 		modelName = resolveModelName(req.Model, h.manager.ListConfiguredModels())
@@ -140,75 +356,280 @@ func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint
 		return
 	}
 
+	client := clientKey(r, cfg)
+	target, abTest, abVariant := cfg.ABVariant(modelName, client)
+	if abTest != "" && target != modelName {
+		log.Printf("[api] A/B test %s: serving %s with variant %s (%s)", abTest, modelName, abVariant, target)
+	}
+	modelName = target
+
+	if override := r.Header.Get(modelOverrideHeader); override != "" {
+		if ip := middleware.ClientIP(r); !cfg.IsTrusted(ip) {
+			log.Printf("[api] Ignoring %s from untrusted client %s", modelOverrideHeader, ip)
+		} else {
+			overrideName := cfg.ResolveAlias(override)
+			if overrideName == "" {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("%s model %q not found", modelOverrideHeader, override))
+				return
+			}
+			log.Printf("[api] %s: serving %q with %s instead of %s", modelOverrideHeader, req.Model, overrideName, modelName)
+			modelName = overrideName
+		}
+	}
+
 	log.Printf("[api] Request for model %q -> %s", modelName, endpoint)
 
-	// Find model config for per-model timeout
-	var timeoutSec int
+	// Find model config for per-model settings
+	var modelCfg config.ModelConfig
 	for _, m := range cfg.Models {
 		if m.Name == modelName {
-			timeoutSec = m.TimeoutSec
+			modelCfg = m
 			break
 		}
 	}
+	bodyLimit := cfg.MaxRequestBodyBytes
+	if modelCfg.MaxRequestBodyBytes > 0 {
+		bodyLimit = modelCfg.MaxRequestBodyBytes
+	}
+	if int64(len(body)) > bodyLimit {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf(
+			"request body of %d bytes exceeds the %d byte limit for model %q", len(body), bodyLimit, modelName))
+		return
+	}
+	if endpoint == "/v1/chat/completions" && !modelCfg.SupportsVision && hasImageContent(bodyMap) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("model %q does not support image input", modelName))
+		return
+	}
 
-	// Ensure model is loaded (lazy loading)
-	loadTimeout := 180 * time.Second
-	ctx, cancel := context.WithTimeout(r.Context(), loadTimeout)
-	defer cancel()
+	rateLimit, limitKey := effectiveLimit(cfg, modelCfg, client)
 
-	backend, err := h.manager.EnsureModel(ctx, modelName)
-	if err != nil {
-		log.Printf("[api] Failed to ensure model %q: %v", modelName, err)
-		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("failed to load model: %v", err))
-		return
+	if rateLimit.Enabled {
+		st := h.limiter.allow(limitKey, rateLimit)
+		st.setHeaders(w.Header())
+		if !st.allowed {
+			writeError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded for model %q", modelName))
+			return
+		}
 	}
 
-	backend.IncrActiveReqs()
-	defer backend.DecrActiveReqs()
+	clientLimit := cfg.MaxConcurrent.ClientLimit(client)
+	release, msg := h.concurrency.acquire(client, modelName, clientLimit, modelCfg.MaxConcurrent)
+	if msg != "" && cfg.Queue.Enabled {
+		// Wait for one of the requests holding the slots to finish
+		log.Printf("[queue] %s; request for %s waits for a free slot", msg, modelName)
+		waitCtx, cancel := context.WithTimeout(r.Context(), cfg.Queue.Timeout())
+		release, msg = h.concurrency.wait(waitCtx, client, modelName, clientLimit, modelCfg.MaxConcurrent)
+		cancel()
+		if msg != "" && r.Context().Err() != nil {
+			return // client went away
+		}
+		if msg != "" {
+			msg = fmt.Sprintf("%s; no slot freed within %v", msg, cfg.Queue.Timeout())
+		}
+	}
+	if msg != "" {
+		writeErrorCode(w, http.StatusTooManyRequests, "concurrency_limit", msg)
+		return
+	}
 
 	// Check if streaming is requested
 	isStream := false
-	var bodyMap map[string]interface{}
-	json.Unmarshal(body, &bodyMap)
 	if s, ok := bodyMap["stream"]; ok {
 		if sb, ok := s.(bool); ok {
 			isStream = sb
 		}
 	}
 
-	targetURL := fmt.Sprintf("%s%s", backend.URL(), endpoint)
+	// Apply per-model request policies. bodyMap keeps what the client sent.
+	forward, rewritten, usageInjected := bodyMap, false, false
+	isGeneration := endpoint == "/v1/chat/completions" || endpoint == "/v1/completions"
+	if endpoint == "/v1/chat/completions" && modelCfg.SystemPrompt != "" {
+		if withPrompt, ok := prependSystemPrompt(forward, modelCfg.SystemPrompt); ok {
+			forward, rewritten = withPrompt, true
+		}
+	}
+	if isGeneration && modelCfg.MaxTokens > 0 {
+		if clamped, requested, ok := clampMaxTokens(forward, modelCfg.MaxTokens); ok {
+			if requested != nil {
+				log.Printf("[api] Clamping max_tokens for %s: requested %v, limit %d", modelName, requested, modelCfg.MaxTokens)
+			}
+			forward, rewritten = clamped, true
+		}
+	}
+	if isStream && isGeneration && rateLimit.Enabled && rateLimit.TokensPerMin > 0 {
+		// Streams only report usage when asked; it is needed to charge the
+		// token budget
+		if withUsage, ok := includeStreamUsage(forward); ok {
+			forward, rewritten, usageInjected = withUsage, true, true
+		}
+	}
+	if rewritten {
+		if b, err := json.Marshal(forward); err == nil {
+			body = b
+		}
+	}
+
+	up := upstream{
+		model:     modelCfg,
+		endpoint:  endpoint,
+		body:      body,
+		header:    r.Header.Clone(),
+		stream:    isStream,
+		rateLimit: rateLimit,
+		limitKey:  limitKey,
+		remote:    r.RemoteAddr,
+		requestID: middleware.GetRequestID(r.Context()),
+		abTest:    abTest,
+		abVariant: abVariant,
+
+		usageInjected: usageInjected,
+	}
+	if ip := middleware.ClientIP(r); ip != nil {
+		up.remote = ip.String()
+	}
+
+	if cfg.Queue.Enabled && h.manager.AtCapacity(modelName) {
+		h.enqueueAsync(w, up, cfg.Queue, release)
+		return
+	}
+	defer release()
+
+	// Ensure model is loaded (lazy loading). Allow for queueing on top of the
+	// model's own startup timeout.
+	h.serveModel(r.Context(), w, up, modelCfg.StartupTimeout()+60*time.Second)
+}
+
+// upstream is a validated client request ready to be relayed to a model.
+type upstream struct {
+	model     config.ModelConfig
+	endpoint  string
+	body      []byte
+	header    http.Header
+	stream    bool
+	rateLimit config.RateLimitConfig
+	limitKey  string
+	remote    string // client address, for the in-flight listing
+	requestID string
+	abTest    string // A/B test and variant ("a" or "b") the request belongs to
+	abVariant string
+	// usageInjected is set when the gateway added include_usage itself, so
+	// the usage chunk is not forwarded
+	usageInjected bool
+}
+
+// serveModel loads the model if needed, waiting at most loadTimeout, and
+// relays the request to one of its backends, writing the response to w.
+func (h *Handler) serveModel(ctx context.Context, w http.ResponseWriter, up upstream, loadTimeout time.Duration) {
+	modelName := up.model.Name
+
+	if up.abTest != "" {
+		aw := &abWriter{ResponseWriter: w, status: http.StatusOK}
+		w = aw
+		start := time.Now()
+		defer func() { h.ab.record(up.abTest, up.abVariant, modelName, time.Since(start), aw.status) }()
+	}
+
+	entry := &inflightRequest{
+		RequestID:  up.requestID,
+		Model:      modelName,
+		Endpoint:   up.endpoint,
+		Stream:     up.stream,
+		RemoteAddr: up.remote,
+	}
+	ctx, done := h.inflight.add(ctx, entry)
+	defer done()
+
+	loadCtx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+
+	backend, err := h.manager.EnsureModel(loadCtx, modelName)
+	if err != nil {
+		if entry.cancelled.Load() {
+			writeCancelled(w)
+			return
+		}
+		log.Printf("[api] Failed to ensure model %q: %v", modelName, err)
+		if errors.Is(err, process.ErrStartupTimeout) {
+			writeError(w, http.StatusServiceUnavailable, fmt.Sprintf(
+				"model %q did not become ready within %ds; raise startup_timeout_sec if it needs longer to load",
+				modelName, int(up.model.StartupTimeout().Seconds())))
+			return
+		}
+		if errors.Is(err, process.ErrModelDraining) {
+			writeErrorCode(w, http.StatusServiceUnavailable, "model_draining", fmt.Sprintf(
+				"model %q is draining and not accepting new requests; retry once it has unloaded", modelName))
+			return
+		}
+		if errors.Is(err, process.ErrBackendsUnhealthy) {
+			writeErrorCode(w, http.StatusServiceUnavailable, "backend_unavailable", fmt.Sprintf(
+				"every backend of model %q is failing its health check", modelName))
+			return
+		}
+		if errors.Is(err, process.ErrQueueFlushed) {
+			writeErrorCode(w, http.StatusServiceUnavailable, "queue_flushed", fmt.Sprintf(
+				"request for model %q was removed from the queue by an operator", modelName))
+			return
+		}
+		if errors.Is(err, process.ErrQueueTimeout) {
+			writeError(w, http.StatusRequestTimeout, fmt.Sprintf("timed out waiting for a slot for model %q", modelName))
+			return
+		}
+		writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("failed to load model: %v", err))
+		return
+	}
+
+	backend.IncrActiveReqs()
+	defer h.manager.ReleaseBackend(backend)
+
+	path, native := nativeEndpoints[up.endpoint]
+	if !native {
+		path = up.endpoint
+	}
+	targetURL := fmt.Sprintf("%s%s", backend.URL(), path)
 
 	var reqCtx context.Context
 	var reqCancel context.CancelFunc
-	if timeoutSec > 0 && !isStream {
-		reqCtx, reqCancel = context.WithTimeout(r.Context(), time.Duration(timeoutSec)*time.Second)
+	if timeoutSec := up.model.TimeoutSec; timeoutSec > 0 && !up.stream {
+		reqCtx, reqCancel = context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
 	} else {
-		reqCtx, reqCancel = context.WithCancel(r.Context())
+		reqCtx, reqCancel = context.WithCancel(ctx)
 	}
 	defer reqCancel()
 
-	proxyReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, targetURL, strings.NewReader(string(body)))
+	proxyReq, err := http.NewRequestWithContext(reqCtx, http.MethodPost, targetURL, strings.NewReader(string(up.body)))
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to create proxy request")
 		return
 	}
 
-	for key, values := range r.Header {
+	for key, values := range up.header {
 		for _, v := range values {
 			proxyReq.Header.Add(key, v)
 		}
 	}
 	proxyReq.Header.Set("Content-Type", "application/json")
+	proxyReq.Header.Del(modelOverrideHeader)
+	// Clients must not be able to pass as gateway-originated traffic
+	proxyReq.Header.Del(process.InternalHeader)
 
-	client := &http.Client{Timeout: 0}
-
-	resp, err := client.Do(proxyReq)
+	start := time.Now()
+	resp, err := backend.HTTPClient().Do(proxyReq)
 	if err != nil {
+		if entry.cancelled.Load() {
+			writeCancelled(w)
+			return
+		}
 		log.Printf("[api] Proxy request failed: %v", err)
 		writeError(w, http.StatusBadGateway, "backend request failed")
 		return
 	}
 	defer resp.Body.Close()
+	defer func() {
+		// Tokenizer calls are not generations and would skew the percentiles
+		if resp.StatusCode < 400 && !native {
+			h.latency.record(modelName, time.Since(start))
+		}
+	}()
 
 	for key, values := range resp.Header {
 		for _, v := range values {
@@ -216,7 +637,7 @@ func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint
 		}
 	}
 
-	if isStream {
+	if up.stream {
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
@@ -229,11 +650,24 @@ func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint
 			return
 		}
 
-		buf := make([]byte, 4096)
+		cfg := h.manager.GetConfig()
+		chunkSize := up.model.StreamChunkSize
+		if chunkSize <= 0 {
+			chunkSize = cfg.StreamChunkSize
+		}
+		chargeTokens := up.rateLimit.Enabled && up.rateLimit.TokensPerMin > 0
+		usage := streamUsage{strip: up.usageInjected}
+		next := streamReader(resp.Body, chunkSize, cfg.StreamFlushOnNewline)
 		for {
-			n, err := resp.Body.Read(buf)
-			if n > 0 {
-				_, writeErr := w.Write(buf[:n])
+			chunk, err := next()
+			if chargeTokens {
+				chunk = usage.scan(chunk)
+				if err != nil {
+					chunk = append(chunk[:len(chunk):len(chunk)], usage.rest()...)
+				}
+			}
+			if len(chunk) > 0 {
+				_, writeErr := w.Write(chunk)
 				if writeErr != nil {
 					log.Printf("[api] Error writing stream: %v", writeErr)
 					break
@@ -241,17 +675,200 @@ func (h *Handler) proxyToModel(w http.ResponseWriter, r *http.Request, endpoint
 				flusher.Flush()
 			}
 			if err != nil {
-				if err != io.EOF {
+				if entry.cancelled.Load() {
+					// Headers are gone; end the stream with an error event
+					fmt.Fprintf(w, "data: {\"error\":{\"message\":%q,\"code\":\"request_cancelled\"}}\n\n", cancelledMessage)
+					flusher.Flush()
+				} else if err != io.EOF {
 					log.Printf("[api] Error reading stream: %v", err)
 				}
 				break
 			}
 		}
+		if chargeTokens {
+			h.limiter.consumeTokens(up.limitKey, up.rateLimit, usage.completionTokens)
+		}
 	} else {
-		respBody, _ := io.ReadAll(resp.Body)
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil && entry.cancelled.Load() {
+			writeCancelled(w)
+			return
+		}
 		w.WriteHeader(resp.StatusCode)
 		w.Write(respBody)
+
+		if up.rateLimit.Enabled && up.rateLimit.TokensPerMin > 0 {
+			var usage usageResponse
+			if json.Unmarshal(respBody, &usage) == nil {
+				h.limiter.consumeTokens(up.limitKey, up.rateLimit, usage.Usage.CompletionTokens)
+			}
+		}
+	}
+}
+
+// streamReader returns a function yielding the backend's stream in pieces of
+// at most size bytes, each of which is forwarded and flushed on its own.
+// With onNewline, pieces also end after every newline.
+func streamReader(body io.Reader, size int, onNewline bool) func() ([]byte, error) {
+	size = max(size, 16) // bufio's minimum
+	if onNewline {
+		br := bufio.NewReaderSize(body, size)
+		return func() ([]byte, error) {
+			line, err := br.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				err = nil // a line longer than size goes out in pieces
+			}
+			return line, err
+		}
 	}
+	buf := make([]byte, size)
+	return func() ([]byte, error) {
+		n, err := body.Read(buf)
+		return buf[:n], err
+	}
+}
+
+// streamUsage picks the usage object out of an SSE stream as it is
+// forwarded. With stream_options.include_usage the backend sends it in the
+// last chunk before [DONE].
+type streamUsage struct {
+	// strip drops the usage-only chunk, for clients that did not ask for it
+	// and may expect every chunk to have choices[0]
+	strip            bool
+	line             []byte // partial line carried over between chunks
+	skipBlank        bool   // the line before was stripped; so is its blank terminator
+	completionTokens int
+}
+
+// scan records usage from the next piece of the stream and returns what of
+// it to forward. When stripping, lines are only forwarded once complete.
+func (u *streamUsage) scan(chunk []byte) []byte {
+	var out []byte
+	if !u.strip {
+		out = chunk
+	}
+	for {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			u.line = append(u.line, chunk...)
+			return out
+		}
+		u.line = append(u.line, chunk[:i+1]...)
+		usageOnly := u.parseLine()
+		if u.strip {
+			blank := len(bytes.TrimSpace(u.line)) == 0
+			switch {
+			case usageOnly:
+				u.skipBlank = true
+			case blank && u.skipBlank:
+				u.skipBlank = false
+			default:
+				u.skipBlank = false
+				out = append(out, u.line...)
+			}
+		}
+		u.line = u.line[:0]
+		chunk = chunk[i+1:]
+	}
+}
+
+// rest returns the unterminated last line a stripping scan held back.
+func (u *streamUsage) rest() []byte {
+	if !u.strip {
+		return nil
+	}
+	return u.line
+}
+
+// parseLine records the usage in the current line, reporting whether the
+// line is a chunk carrying only usage.
+func (u *streamUsage) parseLine() bool {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(u.line), []byte("data:"))
+	if !ok || !bytes.Contains(data, []byte(`"usage"`)) {
+		return false
+	}
+	var resp struct {
+		usageResponse
+		Choices []json.RawMessage `json:"choices"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &resp) != nil {
+		return false
+	}
+	if resp.Usage.CompletionTokens > 0 {
+		u.completionTokens = resp.Usage.CompletionTokens
+	}
+	return resp.Choices != nil && len(resp.Choices) == 0
+}
+
+// includeStreamUsage returns a copy of a streaming request with
+// stream_options.include_usage set, unless the client already set it.
+func includeStreamUsage(bodyMap map[string]interface{}) (map[string]interface{}, bool) {
+	opts, _ := bodyMap["stream_options"].(map[string]interface{})
+	if opts["include_usage"] == true {
+		return nil, false
+	}
+	withUsage := make(map[string]interface{}, len(opts)+1)
+	for k, v := range opts {
+		withUsage[k] = v
+	}
+	withUsage["include_usage"] = true
+
+	out := make(map[string]interface{}, len(bodyMap)+1)
+	for k, v := range bodyMap {
+		out[k] = v
+	}
+	out["stream_options"] = withUsage
+	return out, true
+}
+
+const cancelledMessage = "request was cancelled by an operator"
+
+// writeCancelled answers a request cancelled through /admin/requests/cancel.
+func writeCancelled(w http.ResponseWriter) {
+	// The backend's Content-Length may already have been copied over
+	w.Header().Del("Content-Length")
+	writeErrorCode(w, statusClientClosed, "request_cancelled", cancelledMessage)
+}
+
+// prependSystemPrompt returns a copy of the chat request with a system
+// message added at the front, unless the client already starts with one. The
+// original map and messages slice are left untouched.
+func prependSystemPrompt(bodyMap map[string]interface{}, prompt string) (map[string]interface{}, bool) {
+	messages, ok := bodyMap["messages"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	if len(messages) > 0 {
+		if first, ok := messages[0].(map[string]interface{}); ok && first["role"] == "system" {
+			return nil, false
+		}
+	}
+
+	out := make(map[string]interface{}, len(bodyMap))
+	for k, v := range bodyMap {
+		out[k] = v
+	}
+	withSystem := make([]interface{}, 0, len(messages)+1)
+	withSystem = append(withSystem, map[string]interface{}{"role": "system", "content": prompt})
+	out["messages"] = append(withSystem, messages...)
+	return out, true
+}
+
+// clampMaxTokens returns a copy of the request with max_tokens lowered to
+// limit when the client asked for more or set none. requested is the client's
+// value (nil if absent).
+func clampMaxTokens(bodyMap map[string]interface{}, limit int) (map[string]interface{}, interface{}, bool) {
+	requested, present := bodyMap["max_tokens"]
+	if n, ok := requested.(float64); present && ok && n <= float64(limit) {
+		return nil, nil, false
+	}
+
+	out := make(map[string]interface{}, len(bodyMap)+1)
+	for k, v := range bodyMap {
+		out[k] = v
+	}
+	out["max_tokens"] = limit
+	return out, requested, true
 }
 
 func resolveModelName(requested string, models []config.ModelConfig) string {
@@ -287,13 +904,18 @@ type openaiErrorBody struct {
 }
 
 func writeError(w http.ResponseWriter, status int, message string) {
+	writeErrorCode(w, status, http.StatusText(status), message)
+}
+
+// writeErrorCode writes an OpenAI-style error with a machine-readable code.
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(openaiError{
 		Error: openaiErrorBody{
 			Message: message,
 			Type:    "invalid_request_error",
-			Code:    http.StatusText(status),
+			Code:    code,
 		},
 	})
 }
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/llamawrapper/gateway/internal/process"
+)
+
+func TestStreamReader(t *testing.T) {
+	const stream = "data: {\"a\":1}\n\ndata: [DONE]\n\n"
+	const long = "data: {\"content\":\"hello, world\"}\n" // 33 bytes
+
+	tests := []struct {
+		name      string
+		in        string
+		size      int
+		onNewline bool
+		want      []string
+	}{
+		{name: "fixed pieces", in: stream, size: 16, want: []string{"data: {\"a\":1}\n\nd", "ata: [DONE]\n\n"}},
+		{name: "size raised to bufio minimum", in: stream, size: 1, want: []string{"data: {\"a\":1}\n\nd", "ata: [DONE]\n\n"}},
+		{name: "whole stream", in: stream, size: 64, want: []string{stream}},
+		{name: "per line", in: stream, size: 64, onNewline: true,
+			want: []string{"data: {\"a\":1}\n", "\n", "data: [DONE]\n", "\n"}},
+		{name: "long line split", in: long, size: 16, onNewline: true,
+			want: []string{long[:16], long[16:32], long[32:]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := streamReader(strings.NewReader(tt.in), tt.size, tt.onNewline)
+			var got []string
+			for {
+				chunk, err := next()
+				if len(chunk) > 0 {
+					got = append(got, string(chunk))
+				}
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					break
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pieces = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampMaxTokens(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          map[string]interface{}
+		wantClamped   bool
+		wantRequested interface{}
+	}{
+		{name: "below limit", body: map[string]interface{}{"max_tokens": 100.0}},
+		{name: "at limit", body: map[string]interface{}{"max_tokens": 512.0}},
+		{name: "above limit", body: map[string]interface{}{"max_tokens": 4096.0}, wantClamped: true, wantRequested: 4096.0},
+		{name: "absent", body: map[string]interface{}{"prompt": "hi"}, wantClamped: true},
+		{name: "not a number", body: map[string]interface{}{"max_tokens": "lots"}, wantClamped: true, wantRequested: "lots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(tt.body)
+			out, requested, ok := clampMaxTokens(tt.body, 512)
+			if ok != tt.wantClamped {
+				t.Fatalf("clamped = %v, want %v", ok, tt.wantClamped)
+			}
+			if !ok {
+				return
+			}
+			if out["max_tokens"] != 512 {
+				t.Errorf("max_tokens = %v, want 512", out["max_tokens"])
+			}
+			if requested != tt.wantRequested {
+				t.Errorf("requested = %v, want %v", requested, tt.wantRequested)
+			}
+			if len(tt.body) != before || (tt.wantRequested != nil && tt.body["max_tokens"] != tt.wantRequested) {
+				t.Errorf("original body modified: %v", tt.body)
+			}
+		})
+	}
+}
+
+func TestStreamUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   int
+	}{
+		{name: "no usage", chunks: []string{"data: {\"choices\":[]}\n\n", "data: [DONE]\n\n"}},
+		{name: "final usage chunk", want: 42, chunks: []string{
+			"data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n",
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":7,\"completion_tokens\":42}}\n\n",
+			"data: [DONE]\n\n",
+		}},
+		{name: "usage split across chunks", want: 42, chunks: []string{
+			"data: {\"choices\":[],\"us", "age\":{\"completion_tokens\":4", "2}}\n", "\ndata: [DONE]\n\n",
+		}},
+		{name: "no space after data", want: 3, chunks: []string{"data:{\"usage\":{\"completion_tokens\":3}}\n\n"}},
+		{name: "unterminated line ignored", chunks: []string{"data: {\"usage\":{\"completion_tokens\":3}}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u streamUsage
+			for _, c := range tt.chunks {
+				u.scan([]byte(c))
+			}
+			if u.completionTokens != tt.want {
+				t.Errorf("completionTokens = %d, want %d", u.completionTokens, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamUsageStrip(t *testing.T) {
+	const content = "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n"
+	const usage = "data: {\"choices\":[],\"usage\":{\"completion_tokens\":42}}\n\n"
+	const done = "data: [DONE]\n\n"
+	tests := []struct {
+		name   string
+		chunks []string
+		want   string
+	}{
+		{name: "usage chunk dropped", chunks: []string{content, usage, done}, want: content + done},
+		{name: "split across pieces", chunks: []string{content[:10], content[10:] + usage[:20], usage[20:] + done},
+			want: content + done},
+		{name: "usage alongside choices kept", chunks: []string{
+			"data: {\"choices\":[{\"delta\":{}}],\"usage\":{\"completion_tokens\":42}}\n\n", done,
+		}, want: "data: {\"choices\":[{\"delta\":{}}],\"usage\":{\"completion_tokens\":42}}\n\n" + done},
+		{name: "unterminated tail forwarded", chunks: []string{content, "data: [DONE]"}, want: content + "data: [DONE]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := streamUsage{strip: true}
+			var out []byte
+			for _, c := range tt.chunks {
+				out = append(out, u.scan([]byte(c))...)
+			}
+			out = append(out, u.rest()...)
+			if string(out) != tt.want {
+				t.Errorf("forwarded %q, want %q", out, tt.want)
+			}
+			if u.completionTokens != 42 && strings.Contains(strings.Join(tt.chunks, ""), "42") {
+				t.Errorf("completionTokens = %d, want 42", u.completionTokens)
+			}
+		})
+	}
+}
+
+func TestIncludeStreamUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    map[string]interface{}
+		wantSet bool
+	}{
+		{name: "no stream_options", body: map[string]interface{}{"stream": true}, wantSet: true},
+		{name: "other options kept", body: map[string]interface{}{"stream_options": map[string]interface{}{"x": 1}}, wantSet: true},
+		{name: "explicitly off", body: map[string]interface{}{"stream_options": map[string]interface{}{"include_usage": false}}, wantSet: true},
+		{name: "already on", body: map[string]interface{}{"stream_options": map[string]interface{}{"include_usage": true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orig, _ := tt.body["stream_options"].(map[string]interface{})
+			origLen := len(orig)
+			out, ok := includeStreamUsage(tt.body)
+			if ok != tt.wantSet {
+				t.Fatalf("set = %v, want %v", ok, tt.wantSet)
+			}
+			if !ok {
+				return
+			}
+			opts := out["stream_options"].(map[string]interface{})
+			if opts["include_usage"] != true {
+				t.Errorf("include_usage = %v, want true", opts["include_usage"])
+			}
+			for k, v := range orig {
+				if k != "include_usage" && opts[k] != v {
+					t.Errorf("stream_options[%q] = %v, want %v", k, opts[k], v)
+				}
+			}
+			if len(orig) != origLen {
+				t.Errorf("original stream_options modified: %v", orig)
+			}
+		})
+	}
+}
+
+// TestInternalHeaderStripped checks that clients cannot pass their traffic
+// off as the gateway's own.
+func TestInternalHeaderStripped(t *testing.T) {
+	var got atomic.Value
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.Header.Get(process.InternalHeader))
+		w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer backend.Close()
+	h := testHandler(t, "llama_server_path: /bin/true\nmodels:\n  - {name: m, external_url: \""+backend.URL+"\"}\n")
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions",
+		strings.NewReader(`{"model":"m","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set(process.InternalHeader, "1")
+	rec := httptest.NewRecorder()
+	h.handleChatCompletions(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if v := got.Load(); v != "" {
+		t.Errorf("backend got %s: %q, want it stripped", process.InternalHeader, v)
+	}
+}
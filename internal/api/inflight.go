@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/middleware"
+)
+
+// statusClientClosed is nginx's 499, sent when an operator cancels a request.
+const statusClientClosed = 499
+
+// inflightRequest is a request being served, which an operator can cancel.
+type inflightRequest struct {
+	ID         string    `json:"id"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Model      string    `json:"model"`
+	Endpoint   string    `json:"endpoint"`
+	Stream     bool      `json:"stream"`
+	RemoteAddr string    `json:"remote_addr"`
+	StartedAt  time.Time `json:"started_at"`
+
+	cancel    context.CancelFunc
+	cancelled atomic.Bool
+}
+
+// inflightRegistry tracks requests from the time they start waiting for a
+// model until their response is complete.
+type inflightRegistry struct {
+	mu   sync.Mutex
+	reqs map[string]*inflightRequest
+}
+
+func newInflightRegistry() *inflightRegistry {
+	return &inflightRegistry{reqs: make(map[string]*inflightRequest)}
+}
+
+// add registers a request and returns a context that is cancelled when the
+// request is, plus a function that unregisters it.
+func (reg *inflightRegistry) add(ctx context.Context, req *inflightRequest) (context.Context, func()) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	req.ID = fmt.Sprintf("inf_%x", b)
+	req.StartedAt = time.Now()
+	ctx, req.cancel = context.WithCancel(ctx)
+
+	reg.mu.Lock()
+	reg.reqs[req.ID] = req
+	reg.mu.Unlock()
+
+	return ctx, func() {
+		reg.mu.Lock()
+		delete(reg.reqs, req.ID)
+		reg.mu.Unlock()
+		req.cancel()
+	}
+}
+
+// list returns the in-flight requests, oldest first.
+func (reg *inflightRegistry) list() []*inflightRequest {
+	reg.mu.Lock()
+	out := make([]*inflightRequest, 0, len(reg.reqs))
+	for _, req := range reg.reqs {
+		out = append(out, req)
+	}
+	reg.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out
+}
+
+// cancel stops the request with the given ID, reporting whether it existed.
+func (reg *inflightRegistry) cancel(id string) (*inflightRequest, bool) {
+	reg.mu.Lock()
+	req, ok := reg.reqs[id]
+	reg.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	req.cancelled.Store(true)
+	req.cancel()
+	return req, true
+}
+
+// handleListRequests serves GET /admin/requests.
+func (h *Handler) handleListRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	reqs := h.inflight.list()
+	type item struct {
+		*inflightRequest
+		ElapsedSec float64 `json:"elapsed_sec"`
+	}
+	data := make([]item, 0, len(reqs))
+	for _, req := range reqs {
+		data = append(data, item{req, time.Since(req.StartedAt).Seconds()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"requests": data})
+}
+
+// handleCancelRequest serves POST /admin/requests/cancel {"id": "..."}.
+func (h *Handler) handleCancelRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.requireTrusted(w, r) {
+		return
+	}
+
+	var body struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ID == "" {
+		writeError(w, http.StatusBadRequest, "id is required")
+		return
+	}
+	req, ok := h.inflight.cancel(body.ID)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no in-flight request %q", body.ID))
+		return
+	}
+	log.Printf("[api] Cancelled in-flight request %s (%s %s, running %v) on behalf of %s",
+		req.ID, req.Model, req.Endpoint, time.Since(req.StartedAt).Round(time.Second), middleware.ClientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": req.ID, "cancelled": true})
+}
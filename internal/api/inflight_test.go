@@ -0,0 +1,85 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCancelInflightStream(t *testing.T) {
+	backendDone := make(chan struct{})
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(backendDone)
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := 0; ; i++ {
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":\"%d\"}}]}\n\n", i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(20 * time.Millisecond):
+			}
+		}
+	}))
+	defer backend.Close()
+
+	h := testHandler(t, "llama_server_path: /bin/true\ntrusted_subnets: [127.0.0.0/8]\n"+
+		"models:\n  - {name: m, external_url: \""+backend.URL+"\"}\n")
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	h.RegisterAdminRoutes(mux)
+	gw := httptest.NewServer(mux)
+	defer gw.Close()
+
+	resp, err := http.Post(gw.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"m","stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body := bufio.NewReader(resp.Body)
+	if line, err := body.ReadString('\n'); err != nil || !strings.HasPrefix(line, "data: ") {
+		t.Fatalf("first line = %q, %v; want a data event", line, err)
+	}
+
+	reqs := h.inflight.list()
+	if len(reqs) != 1 {
+		t.Fatalf("%d in-flight requests, want 1", len(reqs))
+	}
+	cancel, err := http.Post(gw.URL+"/admin/requests/cancel", "application/json",
+		strings.NewReader(`{"id":"`+reqs[0].ID+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel.Body.Close()
+	if cancel.StatusCode != http.StatusOK {
+		t.Fatalf("cancel status = %d, want 200", cancel.StatusCode)
+	}
+
+	rest := make(chan string, 1)
+	go func() {
+		b, _ := io.ReadAll(body)
+		rest <- string(b)
+	}()
+	select {
+	case got := <-rest:
+		if !strings.Contains(got, `"code":"request_cancelled"`) {
+			t.Errorf("stream ended without a request_cancelled event: %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream still open after cancelling")
+	}
+	select {
+	case <-backendDone:
+	case <-time.After(2 * time.Second):
+		t.Error("backend request not cancelled")
+	}
+	if reqs := h.inflight.list(); len(reqs) != 0 {
+		t.Errorf("%d in-flight requests left after cancelling, want 0", len(reqs))
+	}
+}
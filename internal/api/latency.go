@@ -0,0 +1,63 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const latencySamples = 1000 // most recent requests kept per model
+
+// latencyTracker keeps recent request durations per model for the
+// percentiles reported by /v1/models/{id}.
+type latencyTracker struct {
+	mu      sync.Mutex
+	samples map[string]*latencyRing
+}
+
+type latencyRing struct {
+	durations []time.Duration
+	next      int
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{samples: make(map[string]*latencyRing)}
+}
+
+func (lt *latencyTracker) record(model string, d time.Duration) {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	r, ok := lt.samples[model]
+	if !ok {
+		r = &latencyRing{}
+		lt.samples[model] = r
+	}
+	if len(r.durations) < latencySamples {
+		r.durations = append(r.durations, d)
+		return
+	}
+	r.durations[r.next] = d
+	r.next = (r.next + 1) % latencySamples
+}
+
+// percentiles returns the p50 and p95 of the model's recent requests in
+// milliseconds, or zeros if it has served none.
+func (lt *latencyTracker) percentiles(model string) (p50, p95 float64) {
+	lt.mu.Lock()
+	r, ok := lt.samples[model]
+	var sorted []time.Duration
+	if ok {
+		sorted = append(sorted, r.durations...)
+	}
+	lt.mu.Unlock()
+	if len(sorted) == 0 {
+		return 0, 0
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) float64 {
+		idx := int(q * float64(len(sorted)-1))
+		return float64(sorted[idx].Microseconds()) / 1000
+	}
+	return at(0.50), at(0.95)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/process"
+)
+
+// queuedResponse is the 202 body for a request waiting for a model slot.
+type queuedResponse struct {
+	ID               string `json:"id"`
+	Status           string `json:"status"` // "queued" or "processing"
+	QueuePosition    int    `json:"queue_position"`
+	EstimatedWaitSec int    `json:"estimated_wait_sec"`
+	PollURL          string `json:"poll_url"`
+}
+
+// enqueueAsync answers with 202 Accepted and serves the request in the
+// background, storing the response for the client to poll. release frees the
+// request's concurrency slot once the background request is done.
+func (h *Handler) enqueueAsync(w http.ResponseWriter, up upstream, qcfg config.QueueConfig, release func()) {
+	res, ok := h.async.add(up.model.Name, up.stream, qcfg.MaxSize)
+	if !ok {
+		release()
+		writeErrorCode(w, http.StatusServiceUnavailable, "queue_full", fmt.Sprintf(
+			"too many queued requests (%d); retry later", qcfg.MaxSize))
+		return
+	}
+	log.Printf("[queue] Model %s is at capacity; request %s will be answered via poll", up.model.Name, res.ID)
+
+	ctx := process.WithQueueID(context.Background(), res.ID)
+	go func() {
+		defer release()
+		defer res.finish()
+		h.serveModel(ctx, res, up, qcfg.Timeout()+up.model.StartupTimeout())
+	}()
+
+	// The background request may not have reached the queue yet
+	pos, ok := h.manager.QueuePosition(res.ID)
+	if !ok {
+		pos = h.manager.GetQueueLength() + 1
+	}
+	writeQueued(w, res, pos, h.manager)
+}
+
+// handleQueuePoll serves /v1/queue/<id>: 202 while the request is waiting,
+// then the model's response (streamed as SSE for streaming requests). A
+// request that timed out in the queue gets 408.
+func (h *Handler) handleQueuePoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/queue/")
+	res, ok := h.async.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown or expired queue id")
+		return
+	}
+
+	status, header, chunk, done, changed := res.read(0)
+	if status == 0 || (!res.Stream && !done) {
+		pos, _ := h.manager.QueuePosition(id)
+		writeQueued(w, res, pos, h.manager)
+		return
+	}
+
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+	w.Write(chunk)
+	if !res.Stream {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+	flusher.Flush()
+	offset := len(chunk)
+	for !done {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		_, _, chunk, done, changed = res.read(offset)
+		if len(chunk) > 0 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			flusher.Flush()
+			offset += len(chunk)
+		}
+	}
+}
+
+// writeQueued writes the 202 status for a pending request. pos is 0 once the
+// request has left the queue and is being loaded or generated.
+func writeQueued(w http.ResponseWriter, res *asyncResult, pos int, m *process.Manager) {
+	body := queuedResponse{
+		ID:            res.ID,
+		Status:        "processing",
+		QueuePosition: pos,
+		PollURL:       "/v1/queue/" + res.ID,
+	}
+	if pos > 0 {
+		body.Status = "queued"
+		body.EstimatedWaitSec = int(math.Ceil(m.EstimatedQueueWait(pos).Seconds()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", body.PollURL)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(body)
+}
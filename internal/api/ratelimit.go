@@ -0,0 +1,184 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+	"github.com/llamawrapper/gateway/internal/middleware"
+)
+
+// bucket is a token bucket refilled continuously at rate tokens per second.
+type bucket struct {
+	tokens   float64
+	lastFill time.Time
+}
+
+func (b *bucket) refill(now time.Time, rate, capacity float64) {
+	b.tokens += now.Sub(b.lastFill).Seconds() * rate
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.lastFill = now
+}
+
+// rateLimiter enforces per-model limits keyed by model + ":" + client key.
+// Request and token budgets are tracked in separate buckets so a model can
+// limit either or both.
+type rateLimiter struct {
+	mu        sync.Mutex
+	requests  map[string]*bucket
+	tokens    map[string]*bucket
+	lastPrune time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		requests:  make(map[string]*bucket),
+		tokens:    make(map[string]*bucket),
+		lastPrune: time.Now(),
+	}
+}
+
+// limitStatus describes the caller's request budget after a check.
+type limitStatus struct {
+	allowed    bool
+	limit      int           // requests per minute
+	remaining  int           // whole requests left in the bucket
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next request is allowed (when !allowed)
+}
+
+// setHeaders writes the X-RateLimit-* headers, plus Retry-After when the
+// request was refused.
+func (st limitStatus) setHeaders(h http.Header) {
+	if st.limit > 0 {
+		h.Set("X-RateLimit-Limit", strconv.Itoa(st.limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(st.remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(st.reset.Seconds()))))
+	}
+	if !st.allowed {
+		h.Set("Retry-After", strconv.FormatFloat(st.retryAfter.Seconds(), 'f', 2, 64))
+	}
+}
+
+// remaining returns the whole tokens currently in the bucket.
+func (b *bucket) remaining() int {
+	if b.tokens < 0 {
+		return 0
+	}
+	return int(b.tokens)
+}
+
+// allow checks and, if permitted, consumes one request from the key's budget.
+func (rl *rateLimiter) allow(key string, cfg config.RateLimitConfig) limitStatus {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.pruneLocked(now)
+	st := limitStatus{allowed: true}
+
+	if cfg.TokensPerMin > 0 {
+		rate := float64(cfg.TokensPerMin) / 60
+		tb := rl.getBucket(rl.tokens, key, float64(cfg.TokensPerMin), now)
+		tb.refill(now, rate, float64(cfg.TokensPerMin))
+		if tb.tokens <= 0 {
+			st.allowed = false
+			st.retryAfter = time.Duration((1 - tb.tokens) / rate * float64(time.Second))
+		}
+	}
+
+	if cfg.RequestsPerMin > 0 {
+		rate := float64(cfg.RequestsPerMin) / 60
+		burst := float64(cfg.BurstSize)
+		rb := rl.getBucket(rl.requests, key, burst, now)
+		rb.refill(now, rate, burst)
+		if st.allowed {
+			if rb.tokens < 1 {
+				st.allowed = false
+				st.retryAfter = time.Duration((1 - rb.tokens) / rate * float64(time.Second))
+			} else {
+				rb.tokens--
+			}
+		}
+		st.limit = cfg.RequestsPerMin
+		st.remaining = rb.remaining()
+		st.reset = time.Duration((burst - rb.tokens) / rate * float64(time.Second))
+	}
+
+	return st
+}
+
+// consumeTokens debits generated tokens from the key's token budget. The
+// balance may go negative, which blocks the key until it refills.
+func (rl *rateLimiter) consumeTokens(key string, cfg config.RateLimitConfig, n int) {
+	if cfg.TokensPerMin <= 0 || n <= 0 {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	tb := rl.getBucket(rl.tokens, key, float64(cfg.TokensPerMin), now)
+	tb.refill(now, float64(cfg.TokensPerMin)/60, float64(cfg.TokensPerMin))
+	tb.tokens -= float64(n)
+}
+
+func (rl *rateLimiter) getBucket(m map[string]*bucket, key string, capacity float64, now time.Time) *bucket {
+	b, ok := m[key]
+	if !ok {
+		b = &bucket{tokens: capacity, lastFill: now}
+		m[key] = b
+	}
+	return b
+}
+
+// pruneLocked drops buckets idle long enough to have refilled completely.
+func (rl *rateLimiter) pruneLocked(now time.Time) {
+	if now.Sub(rl.lastPrune) < time.Minute {
+		return
+	}
+	rl.lastPrune = now
+	for _, m := range []map[string]*bucket{rl.requests, rl.tokens} {
+		for k, b := range m {
+			if now.Sub(b.lastFill) > 10*time.Minute {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// effectiveLimit picks the rate limit for a client's request to a model, in
+// order of precedence: a client override from the top-level rate_limit, the
+// model's own rate_limit, then the top-level default. It also returns the
+// bucket key, so client overrides and the default are shared across models
+// while model limits are tracked per model.
+func effectiveLimit(cfg *config.Config, model config.ModelConfig, client string) (config.RateLimitConfig, string) {
+	if o, ok := cfg.RateLimit.Overrides[client]; ok {
+		return o, "*:" + client
+	}
+	if model.RateLimit.Enabled {
+		return model.RateLimit, model.Name + ":" + client
+	}
+	return cfg.RateLimit, "*:" + client
+}
+
+// clientKey identifies the caller for rate and concurrency limits: the bearer
+// token if it is one of client_keys, otherwise the client IP (resolved
+// through trusted proxies). Unknown tokens are ignored, so a client cannot
+// get fresh buckets or claim another client's overrides by changing its
+// token.
+func clientKey(r *http.Request, cfg *config.Config) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && cfg.IsClientKey(key) {
+		return key
+	}
+	if ip := middleware.ClientIP(r); ip != nil {
+		return ip.String()
+	}
+	return r.RemoteAddr
+}
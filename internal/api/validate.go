@@ -0,0 +1,112 @@
+package api
+
+import "fmt"
+
+var validRoles = map[string]bool{
+	"system":    true,
+	"user":      true,
+	"assistant": true,
+	"tool":      true,
+	"developer": true,
+}
+
+// validateRequest catches obviously malformed OpenAI requests before they
+// reach llama-server, which otherwise answers with opaque errors. It returns
+// a client-facing message, or "" if the body looks valid.
+func validateRequest(endpoint string, body map[string]interface{}) string {
+	if endpoint == "/v1/chat/completions" {
+		if msg := validateMessages(body["messages"]); msg != "" {
+			return msg
+		}
+	}
+
+	switch endpoint {
+	case "/v1/tokenize":
+		if _, ok := body["content"].(string); !ok {
+			return "content must be a string"
+		}
+	case "/v1/detokenize":
+		if _, ok := body["tokens"].([]interface{}); !ok {
+			return "tokens must be an array"
+		}
+	}
+
+	if v, ok := body["temperature"]; ok && v != nil {
+		t, isNum := v.(float64)
+		if !isNum {
+			return "temperature must be a number"
+		}
+		if t < 0 || t > 2 {
+			return fmt.Sprintf("temperature must be between 0 and 2, got %g", t)
+		}
+	}
+
+	if v, ok := body["max_tokens"]; ok && v != nil {
+		n, isNum := v.(float64)
+		if !isNum || n != float64(int64(n)) {
+			return "max_tokens must be an integer"
+		}
+		if n <= 0 {
+			return fmt.Sprintf("max_tokens must be positive, got %d", int64(n))
+		}
+	}
+
+	return ""
+}
+
+func validateMessages(v interface{}) string {
+	if v == nil {
+		return "messages is required"
+	}
+	messages, ok := v.([]interface{})
+	if !ok {
+		return "messages must be an array"
+	}
+	if len(messages) == 0 {
+		return "messages must not be empty"
+	}
+
+	for i, raw := range messages {
+		msg, ok := raw.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("messages[%d] must be an object", i)
+		}
+		role, ok := msg["role"].(string)
+		if !ok || role == "" {
+			return fmt.Sprintf("messages[%d].role is required", i)
+		}
+		if !validRoles[role] {
+			return fmt.Sprintf("messages[%d].role %q is not one of system, user, assistant, tool, developer", i, role)
+		}
+		content, hasContent := msg["content"]
+		// Assistant messages that only carry tool calls may omit content
+		if _, hasToolCalls := msg["tool_calls"]; role == "assistant" && hasToolCalls {
+			continue
+		}
+		if !hasContent || content == nil {
+			return fmt.Sprintf("messages[%d].content is required", i)
+		}
+		switch content.(type) {
+		case string, []interface{}:
+		default:
+			return fmt.Sprintf("messages[%d].content must be a string or an array of content parts", i)
+		}
+	}
+	return ""
+}
+
+// hasImageContent reports whether any chat message carries an image_url
+// content part.
+func hasImageContent(body map[string]interface{}) bool {
+	messages, _ := body["messages"].([]interface{})
+	for _, raw := range messages {
+		msg, _ := raw.(map[string]interface{})
+		parts, _ := msg["content"].([]interface{})
+		for _, p := range parts {
+			if part, ok := p.(map[string]interface{}); ok && part["type"] == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		body     string
+		want     string
+	}{
+		{name: "valid chat", endpoint: "/v1/chat/completions",
+			body: `{"messages": [{"role": "user", "content": "hi"}], "temperature": 0.7, "max_tokens": 64}`},
+		{name: "missing messages", endpoint: "/v1/chat/completions", body: `{}`, want: "messages is required"},
+		{name: "messages not an array", endpoint: "/v1/chat/completions", body: `{"messages": "hi"}`, want: "messages must be an array"},
+		{name: "empty messages", endpoint: "/v1/chat/completions", body: `{"messages": []}`, want: "messages must not be empty"},
+		{name: "message not an object", endpoint: "/v1/chat/completions", body: `{"messages": ["hi"]}`,
+			want: "messages[0] must be an object"},
+		{name: "missing role", endpoint: "/v1/chat/completions", body: `{"messages": [{"content": "hi"}]}`,
+			want: "messages[0].role is required"},
+		{name: "unknown role", endpoint: "/v1/chat/completions", body: `{"messages": [{"role": "bot", "content": "hi"}]}`,
+			want: `messages[0].role "bot" is not one of system, user, assistant, tool, developer`},
+		{name: "missing content", endpoint: "/v1/chat/completions", body: `{"messages": [{"role": "user"}]}`,
+			want: "messages[0].content is required"},
+		{name: "content parts", endpoint: "/v1/chat/completions",
+			body: `{"messages": [{"role": "user", "content": [{"type": "text", "text": "hi"}]}]}`},
+		{name: "numeric content", endpoint: "/v1/chat/completions", body: `{"messages": [{"role": "user", "content": 5}]}`,
+			want: "messages[0].content must be a string or an array of content parts"},
+		{name: "assistant tool call without content", endpoint: "/v1/chat/completions",
+			body: `{"messages": [{"role": "user", "content": "hi"}, {"role": "assistant", "tool_calls": []}]}`},
+		{name: "completions need no messages", endpoint: "/v1/completions", body: `{"prompt": "hi"}`},
+		{name: "temperature not a number", endpoint: "/v1/completions", body: `{"temperature": "hot"}`,
+			want: "temperature must be a number"},
+		{name: "temperature out of range", endpoint: "/v1/completions", body: `{"temperature": 2.5}`,
+			want: "temperature must be between 0 and 2, got 2.5"},
+		{name: "null temperature", endpoint: "/v1/completions", body: `{"temperature": null}`},
+		{name: "fractional max_tokens", endpoint: "/v1/completions", body: `{"max_tokens": 1.5}`,
+			want: "max_tokens must be an integer"},
+		{name: "zero max_tokens", endpoint: "/v1/completions", body: `{"max_tokens": 0}`,
+			want: "max_tokens must be positive, got 0"},
+		{name: "tokenize content", endpoint: "/v1/tokenize", body: `{"content": "hi"}`},
+		{name: "tokenize without content", endpoint: "/v1/tokenize", body: `{}`, want: "content must be a string"},
+		{name: "detokenize tokens", endpoint: "/v1/detokenize", body: `{"tokens": [1, 2]}`},
+		{name: "detokenize without tokens", endpoint: "/v1/detokenize", body: `{"tokens": "1 2"}`,
+			want: "tokens must be an array"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if got := validateRequest(tt.endpoint, body); got != tt.want {
+				t.Errorf("validateRequest = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,18 @@
 package config
 
 import (
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"hash/fnv"
+	"log"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,33 +26,407 @@ type ModelConfig struct {
 	BatchSize   int      `yaml:"batch_size"`
 	ExtraArgs   []string `yaml:"extra_args"`
 	Aliases     []string `yaml:"aliases"`
-	GPUDevices  string   `yaml:"gpu_devices"`
-	TimeoutSec  int      `yaml:"timeout_sec"`
-	MaxTokens   int      `yaml:"max_tokens"`
-	Instances   int      `yaml:"instances"`
-	AutoDownload *AutoDownloadConfig `yaml:"auto_download"`
+	// AliasPatterns are regular expressions matched against the whole
+	// requested name when no exact name or alias matches.
+	AliasPatterns       []string `yaml:"alias_patterns"`
+	aliasRes            []*regexp.Regexp
+	GPUDevices          string              `yaml:"gpu_devices"`
+	TimeoutSec          int                 `yaml:"timeout_sec"`
+	MaxTokens           int                 `yaml:"max_tokens"`
+	MaxRequestBodyBytes int64               `yaml:"max_request_body_bytes"` // 0 = the global limit
+	StreamChunkSize     int                 `yaml:"stream_chunk_size"`      // 0 = the global size
+	Instances           int                 `yaml:"instances"`
+	AutoDownload        *AutoDownloadConfig `yaml:"auto_download"`
+	LoRAs               []LoRAConfig        `yaml:"loras"`
+	Speculative         *SpeculativeConfig  `yaml:"speculative"`
+	// MMProjPath is the multimodal projector passed as --mmproj. Models with
+	// one accept image input; SupportsVision can also be set explicitly, e.g.
+	// for external backends.
+	MMProjPath     string          `yaml:"mmproj_path"`
+	SupportsVision bool            `yaml:"supports_vision"`
+	RateLimit      RateLimitConfig `yaml:"rate_limit"`
+	MaxConcurrent  int             `yaml:"max_concurrent"` // in-flight requests across all clients; 0 = unlimited
+	Pinned         bool            `yaml:"pinned"`         // never evicted by LRU
+	// Discovered is set for models found by scanning models_dir/model_dirs.
+	Discovered bool `yaml:"-"`
+	// ExternalURL (or several ExternalURLs) points at llama-server instances
+	// running elsewhere. The gateway routes and health-checks them but never
+	// starts, stops or evicts them; model_path is not needed.
+	ExternalURL  string   `yaml:"external_url"`
+	ExternalURLs []string `yaml:"external_urls"`
+	// StartupTimeoutSec bounds how long a new instance may take to pass its
+	// ReadinessPath check (defaults 120 and "/health").
+	StartupTimeoutSec int    `yaml:"startup_timeout_sec"`
+	ReadinessPath     string `yaml:"readiness_path"`
+	// WatchFile reloads running instances when the model file changes on disk.
+	WatchFile bool `yaml:"watch_file"`
+	// SystemPrompt is prepended to chat requests that don't start with a
+	// system message.
+	SystemPrompt string `yaml:"system_prompt"`
+	// WarmupPrompts are sent to each instance as system messages once it is
+	// ready, so their prompt prefixes are already in the KV cache.
+	WarmupPrompts []string `yaml:"warmup_prompts"`
+	// ParallelSlots is llama-server's --parallel (default 8). By default the
+	// context is multiplied by the slot count so each slot gets ContextSize;
+	// set scale_ctx_by_parallel: false to pass ContextSize through unchanged.
+	ParallelSlots      int   `yaml:"parallel_slots"`
+	ScaleCtxByParallel *bool `yaml:"scale_ctx_by_parallel"`
+	// UseUnixSocket talks to llama-server over a Unix socket in the temp dir
+	// instead of TCP on localhost.
+	UseUnixSocket bool `yaml:"use_unix_socket"`
+	// IdleUnloadMin unloads the model after this many idle minutes.
+	// 0 uses the global idle_unload_min; -1 disables idle unload for this model.
+	IdleUnloadMin int `yaml:"idle_unload_min"`
+
+	// Dynamic scaling: instances are added while the average in-flight
+	// requests per instance stays at or above ScaleUpActiveReqs, and removed
+	// down to MinInstances after ScaleDownIdleSec without traffic. Disabled
+	// unless MaxInstances > Instances.
+	MinInstances      int `yaml:"min_instances"`
+	MaxInstances      int `yaml:"max_instances"`
+	ScaleUpActiveReqs int `yaml:"scale_up_active_reqs"`
+	ScaleDownIdleSec  int `yaml:"scale_down_idle_sec"`
+}
+
+// ABTestConfig sends SplitPct percent of clients asking for ModelA to ModelB
+// instead. Each client (API key or IP) consistently gets the same variant.
+type ABTestConfig struct {
+	Name     string  `yaml:"name"`
+	ModelA   string  `yaml:"model_a"`
+	ModelB   string  `yaml:"model_b"`
+	SplitPct float64 `yaml:"split_pct"` // 0-100, share routed to model_b
+}
+
+// ABVariant applies the A/B test for model, if any, to a client's request.
+// It returns the model to serve, the test name and "a" or "b"; test is empty
+// when no test covers model.
+func (c *Config) ABVariant(model, client string) (target, test, variant string) {
+	for _, t := range c.ABTests {
+		if t.ModelA != model {
+			continue
+		}
+		h := fnv.New32a()
+		h.Write([]byte(t.Name + ":" + client))
+		if float64(h.Sum32()%10000) < t.SplitPct*100 {
+			return t.ModelB, t.Name, "b"
+		}
+		return t.ModelA, t.Name, "a"
+	}
+	return model, "", ""
+}
+
+// GroupConfig is a model name that round-robins across several models.
+type GroupConfig struct {
+	Name   string   `yaml:"name"`
+	Models []string `yaml:"models"`
+
+	next *atomic.Uint64 // round-robin counter, shared by copies of the config
+}
+
+// pick returns the group's next model in round-robin order.
+func (g *GroupConfig) pick() string {
+	if g.next == nil {
+		return g.Models[0]
+	}
+	idx := g.next.Add(1) - 1
+	return g.Models[idx%uint64(len(g.Models))]
+}
+
+// ModelDefaults are applied to models discovered in models_dir/model_dirs.
+type ModelDefaults struct {
+	GPULayers   *int `yaml:"gpu_layers"` // default -1 (all layers)
+	ContextSize int  `yaml:"context_size"`
+	Threads     int  `yaml:"threads"`
+	BatchSize   int  `yaml:"batch_size"`
+}
+
+func (d ModelDefaults) apply(mc *ModelConfig) {
+	if d.GPULayers != nil {
+		mc.GPULayers = *d.GPULayers
+	}
+	if d.ContextSize > 0 {
+		mc.ContextSize = d.ContextSize
+	}
+	if d.Threads > 0 {
+		mc.Threads = d.Threads
+	}
+	if d.BatchSize > 0 {
+		mc.BatchSize = d.BatchSize
+	}
+}
+
+// LoRAConfig attaches a LoRA adapter to a model. A zero Scale uses
+// llama-server's default of 1.0.
+type LoRAConfig struct {
+	Path  string  `yaml:"path"`
+	Scale float64 `yaml:"scale"`
+}
+
+// SpeculativeConfig enables speculative decoding with a smaller draft model.
+type SpeculativeConfig struct {
+	DraftModelPath string `yaml:"draft_model_path"`
+	DraftGPULayers int    `yaml:"draft_gpu_layers"` // 0 = llama-server default
+	NumDraft       int    `yaml:"num_draft"`        // max tokens drafted per step; 0 = default
 }
 
 type AutoDownloadConfig struct {
-	Repo     string `yaml:"repo"`
-	File     string `yaml:"file"`
-	LocalDir string `yaml:"local_dir"`
+	Repo        string `yaml:"repo"`
+	File        string `yaml:"file"`
+	LocalDir    string `yaml:"local_dir"`
+	Token       string `yaml:"token"`         // HuggingFace token for private/gated repos
+	TokenEnvVar string `yaml:"token_env_var"` // read the token from this env var instead
+	SHA256      string `yaml:"sha256"`        // expected hex digest, verified after download
+}
+
+// ResolveToken returns the HuggingFace token: an explicit Token, then
+// TokenEnvVar, then the standard HF_TOKEN environment variable.
+func (a *AutoDownloadConfig) ResolveToken() string {
+	if a.Token != "" {
+		return a.Token
+	}
+	if a.TokenEnvVar != "" {
+		return os.Getenv(a.TokenEnvVar)
+	}
+	return os.Getenv("HF_TOKEN")
+}
+
+// IsExternal reports whether the model is served by externally managed
+// llama-server instances.
+func (m *ModelConfig) IsExternal() bool {
+	return len(m.ExternalURLs) > 0
+}
+
+// StartupTimeout returns how long to wait for a new instance to become ready.
+func (m *ModelConfig) StartupTimeout() time.Duration {
+	if m.StartupTimeoutSec <= 0 {
+		return 120 * time.Second
+	}
+	return time.Duration(m.StartupTimeoutSec) * time.Second
+}
+
+// EffectiveContextSize returns the --ctx-size passed to llama-server, which
+// is shared across all parallel slots.
+func (m *ModelConfig) EffectiveContextSize() int {
+	if m.ScaleCtxByParallel != nil && !*m.ScaleCtxByParallel {
+		return m.ContextSize
+	}
+	return m.ContextSize * m.ParallelSlots
+}
+
+// RateLimitConfig is a token-bucket limit. RequestsPerMin and BurstSize bound
+// request count; TokensPerMin (optional) bounds completion tokens.
+type RateLimitConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	RequestsPerMin int  `yaml:"requests_per_min"`
+	BurstSize      int  `yaml:"burst_size"`
+	TokensPerMin   int  `yaml:"tokens_per_min"`
+	// Overrides replace the limit for specific clients, by client key (see
+	// Config.ClientKeys) or IP.
+	// Only read from the top-level rate_limit.
+	Overrides map[string]RateLimitConfig `yaml:"overrides"`
+}
+
+// withDefaults fills in BurstSize for an enabled limit and its overrides.
+func (rl RateLimitConfig) withDefaults() RateLimitConfig {
+	if rl.Enabled && rl.BurstSize <= 0 {
+		rl.BurstSize = max(rl.RequestsPerMin, 1)
+	}
+	if len(rl.Overrides) > 0 {
+		overrides := make(map[string]RateLimitConfig, len(rl.Overrides))
+		for k, o := range rl.Overrides {
+			o.Enabled = true
+			overrides[k] = o.withDefaults()
+		}
+		rl.Overrides = overrides
+	}
+	return rl
+}
+
+// ConcurrencyConfig limits simultaneous requests per client (a client key,
+// or the client IP). 0 means unlimited.
+type ConcurrencyConfig struct {
+	PerClient int            `yaml:"per_client"`
+	Overrides map[string]int `yaml:"overrides"` // per client key or IP
+}
+
+// IsClientKey reports whether key is one of ClientKeys.
+func (c *Config) IsClientKey(key string) bool {
+	for _, k := range c.ClientKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientLimit returns the concurrency limit for a client key.
+func (c ConcurrencyConfig) ClientLimit(client string) int {
+	if n, ok := c.Overrides[client]; ok {
+		return n
+	}
+	return c.PerClient
+}
+
+// MaintenanceConfig puts the gateway in maintenance mode: inference requests
+// get 503 with Retry-After while /health keeps answering. Toggle it with a
+// config reload (SIGHUP); requests already in flight complete.
+type MaintenanceConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	Message       string `yaml:"message"`
+	RetryAfterSec int    `yaml:"retry_after_sec"` // default 60
+}
+
+// CompressionConfig enables gzip for responses of at least MinSize bytes to
+// clients that accept it. Event streams are never compressed.
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	MinSize int  `yaml:"min_size"` // bytes; default 1024
+}
+
+// QueueConfig controls requests that wait for a model slot. With Enabled,
+// queued requests are answered with 202 Accepted and a poll URL instead of
+// holding the connection open.
+type QueueConfig struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxSize    int  `yaml:"max_size"`    // default 100
+	TimeoutSec int  `yaml:"timeout_sec"` // default 300
+}
+
+// Timeout returns how long a request may wait in the queue.
+func (q QueueConfig) Timeout() time.Duration {
+	if q.TimeoutSec <= 0 {
+		return 300 * time.Second
+	}
+	return time.Duration(q.TimeoutSec) * time.Second
+}
+
+// CORSConfig restricts cross-origin access. An empty AllowedOrigins keeps the
+// permissive default ("*"). Origins may use a "*" wildcard in the host, e.g.
+// "https://*.example.com".
+type CORSConfig struct {
+	AllowedOrigins   []string `yaml:"allowed_origins"`
+	AllowedMethods   []string `yaml:"allowed_methods"`
+	AllowedHeaders   []string `yaml:"allowed_headers"`
+	AllowCredentials bool     `yaml:"allow_credentials"`
+	MaxAgeSec        int      `yaml:"max_age_sec"`
 }
 
 type Config struct {
-	ListenAddr      string        `yaml:"listen_addr"`
+	ListenAddr string `yaml:"listen_addr"`
+	// AdminListenAddr serves the /admin endpoints on their own address
+	// instead of ListenAddr, e.g. "127.0.0.1:8001".
+	AdminListenAddr string        `yaml:"admin_listen_addr"`
 	LlamaServerPath string        `yaml:"llama_server_path"`
 	PortRangeStart  int           `yaml:"port_range_start"`
+	PortRangeEnd    int           `yaml:"port_range_end"` // inclusive; default start+999
 	MaxLoadedModels int           `yaml:"max_loaded_models"`
 	HealthCheckSec  int           `yaml:"health_check_sec"`
 	ModelsDir       string        `yaml:"models_dir"`
-	Models          []ModelConfig `yaml:"models"`
+	ModelDirs       []string      `yaml:"model_dirs"` // more directories scanned like models_dir
+	ModelDefaults   ModelDefaults `yaml:"model_defaults"`
+	IdleUnloadMin   int           `yaml:"idle_unload_min"` // default for models; 0 = never
+	MaxRestarts     int           `yaml:"max_restarts"`    // consecutive crashes before giving up
+	// RestartOnReload restarts models whose launch settings changed as soon
+	// as the config is reloaded, instead of on their next request.
+	RestartOnReload bool `yaml:"restart_on_reload"`
+	// RequireLoadedModel makes /health report unready until a model is loaded.
+	RequireLoadedModel bool           `yaml:"require_loaded_model"`
+	Models             []ModelConfig  `yaml:"models"`
+	Groups             []GroupConfig  `yaml:"groups"`
+	ABTests            []ABTestConfig `yaml:"ab_tests"`
+	// RateLimit is the default per-client limit for models without their own
+	// rate_limit; its overrides take precedence over any model limit.
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	// MaxConcurrent caps in-flight requests per client; models can also cap
+	// their own total with max_concurrent.
+	MaxConcurrent ConcurrencyConfig `yaml:"max_concurrent"`
+	// ClientKeys are bearer tokens that identify a client for rate_limit and
+	// max_concurrent. Any other token is ignored in favour of the client IP,
+	// so callers cannot pick their own limits by inventing tokens. This is
+	// not authentication: requests without a listed key are still served.
+	ClientKeys []string `yaml:"client_keys"`
+	// TrustedSubnets lists CIDRs (or single IPs) allowed to use operator
+	// headers such as X-Model-Override.
+	TrustedSubnets []string `yaml:"trusted_subnets"`
+	trustedNets    []*net.IPNet
+	// TrustedProxies lists reverse proxies (CIDRs or IPs) whose
+	// X-Forwarded-For / X-Real-IP headers identify the real client.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	proxyNets      []*net.IPNet
+	CORS           CORSConfig  `yaml:"cors"`
+	Queue          QueueConfig `yaml:"queue"`
+	// MaxRequestBodyBytes caps request bodies for models without their own
+	// max_request_body_bytes. Default 10MB.
+	MaxRequestBodyBytes int64 `yaml:"max_request_body_bytes"`
+	// StreamChunkSize is the largest piece of a streamed response forwarded
+	// at once (default 64 bytes); smaller pieces reach clients sooner.
+	// StreamFlushOnNewline also flushes after every line of SSE data.
+	StreamChunkSize      int               `yaml:"stream_chunk_size"`
+	StreamFlushOnNewline bool              `yaml:"stream_flush_on_newline"`
+	Compression          CompressionConfig `yaml:"compression"`
+	Maintenance          MaintenanceConfig `yaml:"maintenance"`
 
 	configPath string `yaml:"-"`
+	// warnings are problems found while parsing that don't make the config
+	// invalid; Load logs them and ValidateYAML returns them.
+	warnings []ValidationError
 }
 
 func (c *Config) ConfigPath() string { return c.configPath }
 
+// IdleUnloadAfter returns how long the model may sit idle before it is
+// unloaded, or 0 if idle unload is disabled for it.
+func (c *Config) IdleUnloadAfter(m *ModelConfig) time.Duration {
+	minutes := m.IdleUnloadMin
+	if minutes == 0 {
+		minutes = c.IdleUnloadMin
+	}
+	if minutes <= 0 {
+		return 0
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// IsTrusted reports whether ip falls within one of the trusted subnets.
+func (c *Config) IsTrusted(ip net.IP) bool {
+	for _, n := range c.trustedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTrustedProxy reports whether ip is one of the trusted reverse proxies.
+func (c *Config) IsTrustedProxy(ip net.IP) bool {
+	for _, n := range c.proxyNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSubnet parses a CIDR, treating a bare IP as a single-host network.
+func parseSubnet(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", s)
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR %q", s)
+	}
+	return ipNet, nil
+}
+
 func expandHome(path string) string {
 	if path == "~" || strings.HasPrefix(path, "~/") {
 		if home, err := os.UserHomeDir(); err == nil {
@@ -60,60 +442,209 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("reading config: %w", err)
 	}
 
+	cfg, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range cfg.warnings {
+		log.Printf("[config] Warning: %s", w.Error())
+	}
+	cfg.configPath = path
+	return cfg, nil
+}
+
+// parse decodes a config file, applies defaults and validates it. Validation
+// failures are returned as *ValidationError, or several of them joined with
+// errors.Join for the name and alias pattern checks; warnings are kept in
+// cfg.warnings.
+func parse(data []byte) (*Config, error) {
 	cfg := &Config{
 		ListenAddr:      ":8000",
 		PortRangeStart:  8081,
 		MaxLoadedModels: 2,
 		HealthCheckSec:  30,
+		MaxRestarts:     5,
+	}
+	warn := func(field, format string, args ...interface{}) {
+		w := invalid(field, format, args...)
+		w.Warning = true
+		cfg.warnings = append(cfg.warnings, *w)
 	}
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
 		return nil, fmt.Errorf("parsing config: %w", err)
 	}
+	if err := expandEnvNodes(&root); err != nil {
+		return nil, err
+	}
+	if root.Kind != 0 {
+		if err := root.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("parsing config: %w", err)
+		}
+	}
 
 	if cfg.LlamaServerPath == "" {
-		return nil, fmt.Errorf("llama_server_path is required")
+		return nil, invalid("llama_server_path", "is required")
+	}
+	cfg.RateLimit = cfg.RateLimit.withDefaults()
+	for i, proxy := range cfg.TrustedProxies {
+		ipNet, err := parseSubnet(proxy)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("trusted_proxies[%d]", i), "%v", err)
+		}
+		cfg.proxyNets = append(cfg.proxyNets, ipNet)
+	}
+	for i, subnet := range cfg.TrustedSubnets {
+		ipNet, err := parseSubnet(subnet)
+		if err != nil {
+			return nil, invalid(fmt.Sprintf("trusted_subnets[%d]", i), "%v", err)
+		}
+		cfg.trustedNets = append(cfg.trustedNets, ipNet)
+	}
+	if cfg.StreamChunkSize < 0 {
+		return nil, invalid("stream_chunk_size", "must not be negative")
+	}
+	if cfg.StreamChunkSize == 0 {
+		cfg.StreamChunkSize = 64
+	}
+	if cfg.MaxRequestBodyBytes < 0 {
+		return nil, invalid("max_request_body_bytes", "must not be negative")
+	}
+	if cfg.MaxRequestBodyBytes == 0 {
+		cfg.MaxRequestBodyBytes = 10 * 1024 * 1024
+	}
+	if cfg.Maintenance.RetryAfterSec <= 0 {
+		cfg.Maintenance.RetryAfterSec = 60
+	}
+	if cfg.Compression.MinSize == 0 {
+		cfg.Compression.MinSize = 1024
+	}
+	if cfg.Queue.MaxSize == 0 {
+		cfg.Queue.MaxSize = 100
+	}
+	if cfg.PortRangeEnd == 0 {
+		cfg.PortRangeEnd = cfg.PortRangeStart + 999
+	}
+	if cfg.PortRangeEnd < cfg.PortRangeStart {
+		return nil, invalid("port_range_end", "%d must not be below port_range_start (%d)", cfg.PortRangeEnd, cfg.PortRangeStart)
 	}
 
 	// Expand ~ in paths
 	cfg.LlamaServerPath = expandHome(cfg.LlamaServerPath)
 	cfg.ModelsDir = expandHome(cfg.ModelsDir)
+	for i := range cfg.ModelDirs {
+		cfg.ModelDirs[i] = expandHome(cfg.ModelDirs[i])
+	}
 	for i := range cfg.Models {
 		cfg.Models[i].ModelPath = expandHome(cfg.Models[i].ModelPath)
+		cfg.Models[i].MMProjPath = expandHome(cfg.Models[i].MMProjPath)
 		for j := range cfg.Models[i].ExtraArgs {
 			cfg.Models[i].ExtraArgs[j] = expandHome(cfg.Models[i].ExtraArgs[j])
 		}
+		if sp := cfg.Models[i].Speculative; sp != nil {
+			sp.DraftModelPath = expandHome(sp.DraftModelPath)
+		}
+		for j := range cfg.Models[i].LoRAs {
+			cfg.Models[i].LoRAs[j].Path = expandHome(cfg.Models[i].LoRAs[j].Path)
+		}
 	}
 
-	// Auto-detect models from models_dir
+	// Auto-detect models from models_dir and model_dirs. Explicitly
+	// configured models win over discovered files with the same name or path.
+	nameSet := make(map[string]bool)
+	pathSet := make(map[string]bool)
+	for _, m := range cfg.Models {
+		nameSet[m.Name] = true
+		pathSet[m.ModelPath] = true
+		for _, alias := range m.Aliases {
+			nameSet[alias] = true
+		}
+	}
+	type scanDir struct{ field, path string }
+	var scanDirs []scanDir
 	if cfg.ModelsDir != "" {
-		discovered, err := ScanModelsDir(cfg.ModelsDir)
+		scanDirs = append(scanDirs, scanDir{"models_dir", cfg.ModelsDir})
+	}
+	for i, dir := range cfg.ModelDirs {
+		scanDirs = append(scanDirs, scanDir{fmt.Sprintf("model_dirs[%d]", i), dir})
+	}
+	for _, dir := range scanDirs {
+		discovered, err := ScanModelsDir(dir.path)
 		if err != nil {
-			return nil, fmt.Errorf("scanning models_dir %q: %w", cfg.ModelsDir, err)
-		}
-		nameSet := make(map[string]bool)
-		pathSet := make(map[string]bool)
-		for _, m := range cfg.Models {
-			nameSet[m.Name] = true
-			pathSet[m.ModelPath] = true
+			return nil, invalid(dir.field, "scanning %q: %v", dir.path, err)
 		}
 		for _, d := range discovered {
-			if !nameSet[d.Name] && !pathSet[d.ModelPath] {
-				cfg.Models = append(cfg.Models, d)
+			if nameSet[d.Name] || pathSet[d.ModelPath] {
+				continue
 			}
+			cfg.ModelDefaults.apply(&d)
+			nameSet[d.Name] = true
+			pathSet[d.ModelPath] = true
+			cfg.Models = append(cfg.Models, d)
 		}
 	}
 
 	if len(cfg.Models) == 0 {
-		return nil, fmt.Errorf("at least one model must be configured (or set models_dir)")
+		return nil, invalid("models", "at least one model must be configured (or set models_dir/model_dirs)")
 	}
 
+	// Bad alias patterns and name collisions are all reported together
+	var nameErrs []error
 	for i, m := range cfg.Models {
 		if m.Name == "" {
-			return nil, fmt.Errorf("model[%d]: name is required", i)
+			return nil, invalid(fmt.Sprintf("models[%d].name", i), "is required")
 		}
-		if m.ModelPath == "" && m.AutoDownload == nil {
-			return nil, fmt.Errorf("model[%d] (%s): model_path or auto_download is required", i, m.Name)
+		if m.ExternalURL != "" {
+			cfg.Models[i].ExternalURLs = append([]string{m.ExternalURL}, m.ExternalURLs...)
+		}
+		for j, u := range cfg.Models[i].ExternalURLs {
+			if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+				return nil, invalid(fmt.Sprintf("models[%d].external_url", i), "%q must start with http:// or https:// (model %s)", u, m.Name)
+			}
+			cfg.Models[i].ExternalURLs[j] = strings.TrimSuffix(u, "/")
+		}
+		if m.ModelPath == "" && m.AutoDownload == nil && !cfg.Models[i].IsExternal() {
+			return nil, invalid(fmt.Sprintf("models[%d].model_path", i), "model_path, auto_download or external_url is required (model %s)", m.Name)
+		}
+		if m.StreamChunkSize < 0 {
+			return nil, invalid(fmt.Sprintf("models[%d].stream_chunk_size", i), "must not be negative (model %s)", m.Name)
+		}
+		if m.MaxRequestBodyBytes < 0 {
+			return nil, invalid(fmt.Sprintf("models[%d].max_request_body_bytes", i), "must not be negative (model %s)", m.Name)
+		}
+		if m.MMProjPath != "" {
+			cfg.Models[i].SupportsVision = true
+			if _, err := os.Stat(m.MMProjPath); err != nil {
+				warn(fmt.Sprintf("models[%d].mmproj_path", i), "%v (model %s)", err, m.Name)
+			}
+		}
+		if sp := m.Speculative; sp != nil {
+			if sp.DraftModelPath == "" {
+				return nil, invalid(fmt.Sprintf("models[%d].speculative.draft_model_path", i), "is required (model %s)", m.Name)
+			}
+			if _, err := os.Stat(sp.DraftModelPath); err != nil {
+				warn(fmt.Sprintf("models[%d].speculative.draft_model_path", i), "%v (model %s)", err, m.Name)
+			}
+		}
+		for j, pattern := range m.AliasPatterns {
+			re, err := regexp.Compile("^(?:" + pattern + ")$")
+			if err != nil {
+				nameErrs = append(nameErrs, invalid(fmt.Sprintf("models[%d].alias_patterns[%d]", i, j), "invalid regular expression %q: %v", pattern, err))
+				continue
+			}
+			cfg.Models[i].aliasRes = append(cfg.Models[i].aliasRes, re)
+		}
+		for j, lora := range m.LoRAs {
+			if lora.Path == "" {
+				return nil, invalid(fmt.Sprintf("models[%d].loras[%d].path", i, j), "is required (model %s)", m.Name)
+			}
+			if _, err := os.Stat(lora.Path); err != nil {
+				warn(fmt.Sprintf("models[%d].loras[%d].path", i, j), "%v (model %s)", err, m.Name)
+			}
+		}
+		if ad := m.AutoDownload; ad != nil && ad.Repo != "" && ad.ResolveToken() == "" {
+			warn(fmt.Sprintf("models[%d].auto_download.token", i), "not set; private or gated repos will fail (model %s)", m.Name)
 		}
 		if m.ContextSize == 0 {
 			cfg.Models[i].ContextSize = 4096
@@ -127,13 +658,165 @@ func Load(path string) (*Config, error) {
 		if m.Instances == 0 {
 			cfg.Models[i].Instances = 1
 		}
+		if m.StartupTimeoutSec == 0 {
+			cfg.Models[i].StartupTimeoutSec = 120
+		}
+		if m.ReadinessPath == "" {
+			cfg.Models[i].ReadinessPath = "/health"
+		} else if !strings.HasPrefix(m.ReadinessPath, "/") {
+			cfg.Models[i].ReadinessPath = "/" + m.ReadinessPath
+		}
+		if m.ParallelSlots == 0 {
+			cfg.Models[i].ParallelSlots = 8
+		}
+		instances := cfg.Models[i].Instances
+		if m.MinInstances == 0 {
+			cfg.Models[i].MinInstances = instances
+		}
+		if m.MaxInstances == 0 {
+			cfg.Models[i].MaxInstances = instances
+		}
+		if cfg.Models[i].MinInstances > instances || cfg.Models[i].MaxInstances < instances {
+			return nil, invalid(fmt.Sprintf("models[%d].instances", i), "need min_instances <= instances <= max_instances (model %s)", m.Name)
+		}
+		if m.ScaleUpActiveReqs == 0 {
+			cfg.Models[i].ScaleUpActiveReqs = 6
+		}
+		if m.ScaleDownIdleSec == 0 {
+			cfg.Models[i].ScaleDownIdleSec = 300
+		}
+		cfg.Models[i].RateLimit = m.RateLimit.withDefaults()
 	}
 
-	cfg.configPath = path
+	nameErrs = append(nameErrs, checkNameCollisions(cfg.Models, cfg.Groups, warn)...)
+	if len(nameErrs) > 0 {
+		return nil, errors.Join(nameErrs...)
+	}
+
+	modelNames := make(map[string]bool, len(cfg.Models))
+	for _, m := range cfg.Models {
+		modelNames[m.Name] = true
+	}
+	for i, g := range cfg.Groups {
+		if g.Name == "" {
+			return nil, invalid(fmt.Sprintf("groups[%d].name", i), "is required")
+		}
+		if len(g.Models) == 0 {
+			return nil, invalid(fmt.Sprintf("groups[%d].models", i), "at least one model is required (group %s)", g.Name)
+		}
+		for _, name := range g.Models {
+			if !modelNames[name] {
+				return nil, invalid(fmt.Sprintf("groups[%d].models", i), "unknown model %q (group %s)", name, g.Name)
+			}
+		}
+		cfg.Groups[i].next = new(atomic.Uint64)
+	}
+	abModels := make(map[string]bool)
+	for i, t := range cfg.ABTests {
+		field := fmt.Sprintf("ab_tests[%d]", i)
+		switch {
+		case t.Name == "":
+			return nil, invalid(field+".name", "is required")
+		case !modelNames[t.ModelA]:
+			return nil, invalid(field+".model_a", "unknown model %q (test %s)", t.ModelA, t.Name)
+		case !modelNames[t.ModelB]:
+			return nil, invalid(field+".model_b", "unknown model %q (test %s)", t.ModelB, t.Name)
+		case t.ModelA == t.ModelB:
+			return nil, invalid(field+".model_b", "must differ from model_a (test %s)", t.Name)
+		case t.SplitPct < 0 || t.SplitPct > 100:
+			return nil, invalid(field+".split_pct", "%g is not between 0 and 100 (test %s)", t.SplitPct, t.Name)
+		case abModels[t.ModelA]:
+			return nil, invalid(field+".model_a", "model %q is already in another A/B test (test %s)", t.ModelA, t.Name)
+		}
+		abModels[t.ModelA] = true
+	}
 
 	return cfg, nil
 }
 
+// checkNameCollisions rejects configs where a requested name could resolve to
+// more than one target: duplicate model or group names, an alias shared by two
+// models, an alias equal to another model's name, or a group named like a
+// model or alias (groups are resolved first and would shadow it). Alias
+// patterns only apply to names nothing else claims, so one matching such a
+// name is just a warning, as is an alias repeating its model's name. Every
+// collision is returned, not just the first.
+func checkNameCollisions(models []ModelConfig, groups []GroupConfig, warn func(field, format string, args ...interface{})) []error {
+	var errs []error
+	nameIdx := make(map[string]int, len(models))
+	for i, m := range models {
+		if j, dup := nameIdx[m.Name]; dup {
+			errs = append(errs, invalid(fmt.Sprintf("models[%d].name", i), "%q is already used by models[%d]", m.Name, j))
+			continue
+		}
+		nameIdx[m.Name] = i
+	}
+
+	type aliasOwner struct{ model, alias int }
+	aliasIdx := make(map[string]aliasOwner)
+	for i, m := range models {
+		for a, alias := range m.Aliases {
+			field := fmt.Sprintf("models[%d].aliases[%d]", i, a)
+			if alias == m.Name {
+				warn(field, "alias %q repeats the model's own name", alias)
+				continue
+			}
+			if j, ok := nameIdx[alias]; ok {
+				errs = append(errs, invalid(field, "alias %q of model %s is the name of models[%d]", alias, m.Name, j))
+				continue
+			}
+			if prev, ok := aliasIdx[alias]; ok && prev.model != i {
+				errs = append(errs, invalid(field, "alias %q of model %s is also an alias of models[%d] (%s, aliases[%d])",
+					alias, m.Name, prev.model, models[prev.model].Name, prev.alias))
+				continue
+			}
+			aliasIdx[alias] = aliasOwner{i, a}
+		}
+	}
+
+	groupIdx := make(map[string]int, len(groups))
+	for i, g := range groups {
+		field := fmt.Sprintf("groups[%d].name", i)
+		if j, ok := nameIdx[g.Name]; ok {
+			errs = append(errs, invalid(field, "group %q has the name of models[%d]", g.Name, j))
+		} else if owner, ok := aliasIdx[g.Name]; ok {
+			errs = append(errs, invalid(field, "group %q is an alias of models[%d] (%s)", g.Name, owner.model, models[owner.model].Name))
+		} else if j, dup := groupIdx[g.Name]; dup {
+			errs = append(errs, invalid(field, "%q is already used by groups[%d]", g.Name, j))
+		} else {
+			groupIdx[g.Name] = i
+		}
+	}
+
+	for i, m := range models {
+		for p, re := range m.aliasRes {
+			field := fmt.Sprintf("models[%d].alias_patterns[%d]", i, p)
+			for j, other := range models {
+				if j == i {
+					continue
+				}
+				if re.MatchString(other.Name) {
+					warn(field, "pattern %q matches the name of models[%d] (%s), which takes precedence",
+						m.AliasPatterns[p], j, other.Name)
+				}
+				for _, alias := range other.Aliases {
+					if re.MatchString(alias) {
+						warn(field, "pattern %q matches alias %q of models[%d] (%s), which takes precedence",
+							m.AliasPatterns[p], alias, j, other.Name)
+					}
+				}
+			}
+			for j, g := range groups {
+				if re.MatchString(g.Name) {
+					warn(field, "pattern %q matches the name of groups[%d], which takes precedence",
+						m.AliasPatterns[p], j)
+				}
+			}
+		}
+	}
+	return errs
+}
+
 // ScanModelsDir scans a directory for .gguf files and returns auto-configured ModelConfigs.
 func ScanModelsDir(dir string) ([]ModelConfig, error) {
 	entries, err := os.ReadDir(dir)
@@ -166,26 +849,38 @@ func ScanModelsDir(dir string) ([]ModelConfig, error) {
 
 	var configs []ModelConfig
 	for _, f := range modelFiles {
-		name := strings.TrimSuffix(f, filepath.Ext(f))
 		mc := ModelConfig{
-			Name:        name,
+			Name:        modelNameFromFile(f),
 			ModelPath:   filepath.Join(dir, f),
 			GPULayers:   -1,
 			ContextSize: 4096,
 			Threads:     4,
 			BatchSize:   512,
 			Instances:   1,
+			Discovered:  true,
 		}
 		if mmprojPath != "" {
-			mc.ExtraArgs = []string{"--mmproj", mmprojPath}
+			mc.MMProjPath = mmprojPath
+			mc.SupportsVision = true
 		}
 		configs = append(configs, mc)
 	}
 	return configs, nil
 }
 
-// ResolveAlias checks if a requested model name matches any configured alias.
+// ResolveAlias checks if a requested model name matches any configured group
+// or alias. Groups take precedence and rotate through their members, so
+// only request routing should call it; lookups use LookupModel.
 func (c *Config) ResolveAlias(requested string) string {
+	if g := c.group(requested); g != nil {
+		return g.pick()
+	}
+	return c.LookupModel(requested)
+}
+
+// LookupModel returns the model a name or alias refers to, or "" if none
+// does. Group names are not resolved.
+func (c *Config) LookupModel(requested string) string {
 	for _, m := range c.Models {
 		if m.Name == requested {
 			return m.Name
@@ -196,5 +891,42 @@ func (c *Config) ResolveAlias(requested string) string {
 			}
 		}
 	}
+	for _, m := range c.Models {
+		for _, re := range m.aliasRes {
+			if re.MatchString(requested) {
+				return m.Name
+			}
+		}
+	}
 	return ""
 }
+
+// GroupModels returns the members of the named group, or nil if there is no
+// such group.
+func (c *Config) GroupModels(name string) []string {
+	if g := c.group(name); g != nil {
+		return g.Models
+	}
+	return nil
+}
+
+func (c *Config) group(name string) *GroupConfig {
+	for i := range c.Groups {
+		if g := &c.Groups[i]; g.Name == name && len(g.Models) > 0 {
+			return g
+		}
+	}
+	return nil
+}
+
+// modelNameFromFile derives a model name from a GGUF file name: the stem with
+// anything other than letters, digits, '.', '-' and '_' replaced by '-'.
+func modelNameFromFile(file string) string {
+	stem := strings.TrimSuffix(file, filepath.Ext(file))
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, stem)
+}
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig returns a minimal config with one external model "m"; global
+// and model are extra top-level and model-level YAML lines.
+func testConfig(global, model string) []byte {
+	return []byte("llama_server_path: /bin/true\n" + global +
+		"models:\n  - name: m\n    external_url: http://127.0.0.1:9\n" + model)
+}
+
+func TestIdleUnloadAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		model  string
+		want   time.Duration
+	}{
+		{name: "disabled", want: 0},
+		{name: "global minutes", global: "idle_unload_min: 15\n", want: 15 * time.Minute},
+		{name: "model overrides global", global: "idle_unload_min: 15\n", model: "    idle_unload_min: 5\n", want: 5 * time.Minute},
+		{name: "model opts out", global: "idle_unload_min: 15\n", model: "    idle_unload_min: -1\n", want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parse(testConfig(tt.global, tt.model))
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := cfg.IdleUnloadAfter(&cfg.Models[0]); got != tt.want {
+				t.Errorf("IdleUnloadAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNameCollisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		wantErr  string // field of the expected ValidationError
+		wantWarn string // substring of the expected warning
+	}{
+		{
+			name: "distinct names",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [a1]}
+  - {name: b, external_url: "http://127.0.0.1:9", alias_patterns: ["b-.*"]}
+groups:
+  - {name: pool, models: [a, b]}
+`,
+		},
+		{
+			name: "duplicate model name",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9"}
+  - {name: a, external_url: "http://127.0.0.1:9"}
+`,
+			wantErr: "models[1].name",
+		},
+		{
+			name: "alias is another model's name",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [b]}
+  - {name: b, external_url: "http://127.0.0.1:9"}
+`,
+			wantErr: "models[0].aliases[0]",
+		},
+		{
+			name: "alias shared by two models",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [x]}
+  - {name: b, external_url: "http://127.0.0.1:9", aliases: [x]}
+`,
+			wantErr: "models[1].aliases[0]",
+		},
+		{
+			name: "group named like a model",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9"}
+  - {name: b, external_url: "http://127.0.0.1:9"}
+groups:
+  - {name: a, models: [a, b]}
+`,
+			wantErr: "groups[0].name",
+		},
+		{
+			name: "group named like an alias",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [fast]}
+groups:
+  - {name: fast, models: [a]}
+`,
+			wantErr: "groups[0].name",
+		},
+		{
+			name: "duplicate group name",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9"}
+groups:
+  - {name: pool, models: [a]}
+  - {name: pool, models: [a]}
+`,
+			wantErr: "groups[1].name",
+		},
+		{
+			name: "pattern matches another model's name",
+			yaml: `
+models:
+  - {name: llama-8b, external_url: "http://127.0.0.1:9"}
+  - {name: llama-70b, external_url: "http://127.0.0.1:9", alias_patterns: ["llama-.*"]}
+`,
+			wantWarn: "matches the name of models[0] (llama-8b)",
+		},
+		{
+			name: "pattern matches a group name",
+			yaml: `
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", alias_patterns: ["p.*"]}
+groups:
+  - {name: pool, models: [a]}
+`,
+			wantWarn: "matches the name of groups[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := parse([]byte("llama_server_path: /bin/true\n" + tt.yaml))
+			var verr *ValidationError
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("parse: %v", err)
+			case tt.wantErr != "" && !errors.As(err, &verr):
+				t.Fatalf("parse error = %v, want a ValidationError for %s", err, tt.wantErr)
+			case tt.wantErr != "" && verr.Field != tt.wantErr:
+				t.Fatalf("error field = %s (%v), want %s", verr.Field, err, tt.wantErr)
+			}
+			var warnings []string
+			if cfg != nil {
+				for _, w := range cfg.warnings {
+					warnings = append(warnings, w.Error())
+				}
+			}
+			got := strings.Join(warnings, "\n")
+			if !strings.Contains(got, tt.wantWarn) {
+				t.Errorf("warnings %q do not contain %q", got, tt.wantWarn)
+			}
+			if tt.wantWarn == "" && got != "" {
+				t.Errorf("unexpected warnings: %s", got)
+			}
+		})
+	}
+}
+
+func TestScanModelsDir(t *testing.T) {
+	touch := func(t *testing.T, dir string, names ...string) {
+		t.Helper()
+		for _, n := range names {
+			if err := os.WriteFile(filepath.Join(dir, n), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("names and mmproj pairing", func(t *testing.T) {
+		dir := t.TempDir()
+		touch(t, dir, "Qwen 2.5 (7B).gguf", "mmproj-f16.GGUF", "notes.txt")
+		if err := os.Mkdir(filepath.Join(dir, "sub.gguf"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		models, err := ScanModelsDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(models) != 1 {
+			t.Fatalf("got %d models, want 1: %+v", len(models), models)
+		}
+		m := models[0]
+		if m.Name != "Qwen-2.5--7B-" {
+			t.Errorf("Name = %q, want %q", m.Name, "Qwen-2.5--7B-")
+		}
+		if want := filepath.Join(dir, "mmproj-f16.GGUF"); m.MMProjPath != want || !m.SupportsVision {
+			t.Errorf("MMProjPath = %q, SupportsVision = %v; want %q, true", m.MMProjPath, m.SupportsVision, want)
+		}
+		if !m.Discovered {
+			t.Error("Discovered not set")
+		}
+	})
+
+	t.Run("ambiguous mmproj is not paired", func(t *testing.T) {
+		dir := t.TempDir()
+		touch(t, dir, "a.gguf", "mmproj-a.gguf", "mmproj-b.gguf")
+
+		models, err := ScanModelsDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(models) != 1 || models[0].MMProjPath != "" {
+			t.Errorf("got %+v, want one model without mmproj", models)
+		}
+	})
+
+	t.Run("configured models win", func(t *testing.T) {
+		dir := t.TempDir()
+		touch(t, dir, "a.gguf", "b.gguf", "c.gguf")
+
+		cfg, err := parse([]byte("llama_server_path: /bin/true\nmodel_dirs: [" + dir + "]\n" +
+			"model_defaults:\n  context_size: 8192\n" +
+			"models:\n  - name: a\n    model_path: /elsewhere/a.gguf\n" +
+			"  - name: other\n    model_path: " + filepath.Join(dir, "b.gguf") + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range cfg.Models {
+			names = append(names, m.Name)
+			if m.Discovered && m.ContextSize != 8192 {
+				t.Errorf("%s: ContextSize = %d, want model_defaults 8192", m.Name, m.ContextSize)
+			}
+		}
+		if got := strings.Join(names, ","); got != "a,other,c" {
+			t.Errorf("models = %s, want a,other,c", got)
+		}
+	})
+}
+
+func TestGroupLookupsDoNotRotate(t *testing.T) {
+	cfg, err := parse([]byte(`
+llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", aliases: [a1]}
+  - {name: b, external_url: "http://127.0.0.1:9", alias_patterns: ["b-.*"]}
+groups:
+  - {name: pool, models: [a, b]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for i := 0; i < 4; i++ {
+		// Lookups between picks must not move the rotation on
+		if name := cfg.LookupModel("pool"); name != "" {
+			t.Errorf("LookupModel(pool) = %q, want \"\"", name)
+		}
+		if members := cfg.GroupModels("pool"); strings.Join(members, ",") != "a,b" {
+			t.Errorf("GroupModels(pool) = %v, want [a b]", members)
+		}
+		got = append(got, cfg.ResolveAlias("pool"))
+	}
+	if s := strings.Join(got, ","); s != "a,b,a,b" {
+		t.Errorf("ResolveAlias(pool) sequence = %s, want a,b,a,b", s)
+	}
+
+	for requested, want := range map[string]string{"a": "a", "a1": "a", "b-large": "b", "c": ""} {
+		if name := cfg.LookupModel(requested); name != want {
+			t.Errorf("LookupModel(%q) = %q, want %q", requested, name, want)
+		}
+	}
+	if cfg.GroupModels("a") != nil {
+		t.Error("GroupModels(a) is not nil for a model name")
+	}
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envRefRe matches $$ (a literal dollar), ${VAR} and ${VAR:-default}.
+var envRefRe = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv substitutes environment variables in s. A reference to an unset
+// variable without a default is an error.
+func expandEnv(s string) (string, error) {
+	var missing string
+	out := envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+		m := envRefRe.FindStringSubmatch(ref)
+		// Like the shell, :- also applies when the variable is empty
+		if v, ok := os.LookupEnv(m[1]); ok && (v != "" || m[2] == "") {
+			return v
+		}
+		if m[2] != "" {
+			return m[3]
+		}
+		if missing == "" {
+			missing = m[1]
+		}
+		return ""
+	})
+	if missing != "" {
+		return "", &ValidationError{Message: "environment variable " + missing + " is not set"}
+	}
+	return out, nil
+}
+
+// expandEnvNodes expands environment references in every scalar value of a
+// parsed YAML document. Mapping keys and comments are left alone.
+func expandEnvNodes(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		v, err := expandEnv(n.Value)
+		if err != nil {
+			ve := err.(*ValidationError)
+			ve.Line = n.Line
+			return ve
+		}
+		if v != n.Value {
+			n.Value = v
+			if n.Style == 0 {
+				// Let plain scalars re-resolve, so ${PORT} can fill an int field
+				n.Tag = ""
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandEnvNodes(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, c := range n.Content {
+			if err := expandEnvNodes(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
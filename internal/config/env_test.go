@@ -0,0 +1,44 @@
+package config
+
+import "testing"
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("GW_TEST_HOST", "gpu-box")
+	t.Setenv("GW_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "no references", in: "plain value", want: "plain value"},
+		{name: "set variable", in: "http://${GW_TEST_HOST}:8080", want: "http://gpu-box:8080"},
+		{name: "default unused", in: "${GW_TEST_HOST:-localhost}", want: "gpu-box"},
+		{name: "default for unset", in: "${GW_TEST_UNSET:-localhost}", want: "localhost"},
+		{name: "default for empty", in: "${GW_TEST_EMPTY:-localhost}", want: "localhost"},
+		{name: "empty without default", in: "[${GW_TEST_EMPTY}]", want: "[]"},
+		{name: "empty default", in: "[${GW_TEST_UNSET:-}]", want: "[]"},
+		{name: "escaped dollar", in: "cost $$5 ${GW_TEST_HOST}", want: "cost $5 gpu-box"},
+		{name: "escaped reference", in: "$${GW_TEST_HOST}", want: "${GW_TEST_HOST}"},
+		{name: "bare dollar untouched", in: "$GW_TEST_HOST", want: "$GW_TEST_HOST"},
+		{name: "unset without default", in: "${GW_TEST_UNSET}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandEnv(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expandEnv(%q) = %q, want error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandEnv(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("expandEnv(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a config problem tied to a field path such as
+// "models[2].model_path". Warnings are reported but don't make a config
+// invalid.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+func invalid(field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// unknownFieldRe matches yaml.v3's KnownFields errors.
+var unknownFieldRe = regexp.MustCompile(`^line (\d+): field (\S+) not found in type (\S+)$`)
+
+// ValidateYAML checks config file contents the same way Load does, without
+// reading or writing the config file. Fields the gateway doesn't recognise
+// are reported as warnings since they are ignored rather than fatal, along
+// with the warnings Load would log.
+func ValidateYAML(data []byte) []ValidationError {
+	var errs []ValidationError
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var strict Config
+	if err := dec.Decode(&strict); err != nil {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			// Syntax errors are reported once, below
+			te = &yaml.TypeError{}
+		}
+		for _, msg := range te.Errors {
+			if m := unknownFieldRe.FindStringSubmatch(msg); m != nil {
+				line, _ := strconv.Atoi(m[1])
+				errs = append(errs, ValidationError{
+					Field:   m[2],
+					Line:    line,
+					Message: "unknown field, ignored",
+					Warning: true,
+				})
+			}
+		}
+	}
+
+	cfg, err := parse(data)
+	if err != nil {
+		return append(errs, validationErrors(err)...)
+	}
+	errs = append(errs, cfg.warnings...)
+	return append(errs, Validate(cfg)...)
+}
+
+// validationErrors lists the problems in an error from parse, which may join
+// several; errors other than ValidationError are reported without a field.
+func validationErrors(err error) []ValidationError {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []ValidationError
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, validationErrors(e)...)
+		}
+		return errs
+	}
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return []ValidationError{*ve}
+	}
+	return []ValidationError{{Message: err.Error()}}
+}
+
+// Validate checks a loaded config against the environment and for problems
+// Load tolerates, reporting all of them rather than stopping at the first.
+func Validate(cfg *Config) []ValidationError {
+	var errs []ValidationError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, *invalid(field, format, args...))
+	}
+
+	// Ports each local model can hold at once
+	var portsPerModel []int
+	for i, m := range cfg.Models {
+		field := fmt.Sprintf("models[%d]", i)
+		if !m.IsExternal() {
+			portsPerModel = append(portsPerModel, max(1, m.Instances, m.MaxInstances))
+		}
+
+		// Auto-downloaded files may legitimately not exist yet
+		if m.ModelPath != "" && !m.IsExternal() {
+			if f, err := os.Open(m.ModelPath); err != nil {
+				if !(m.AutoDownload != nil && os.IsNotExist(err)) {
+					add(field+".model_path", "%v (model %s)", err, m.Name)
+				}
+			} else {
+				f.Close()
+			}
+		}
+
+		if m.GPUDevices != "" {
+			for _, dev := range strings.Split(m.GPUDevices, ",") {
+				if n, err := strconv.Atoi(strings.TrimSpace(dev)); err != nil || n < 0 {
+					add(field+".gpu_devices", "%q is not a comma-separated list of GPU indices (model %s)", m.GPUDevices, m.Name)
+					break
+				}
+			}
+		}
+	}
+
+	// Only max_loaded_models models run at once; count the largest ones
+	sort.Sort(sort.Reverse(sort.IntSlice(portsPerModel)))
+	if cfg.MaxLoadedModels > 0 && len(portsPerModel) > cfg.MaxLoadedModels {
+		portsPerModel = portsPerModel[:cfg.MaxLoadedModels]
+	}
+	need := 0
+	for _, n := range portsPerModel {
+		need += n
+	}
+	if have := cfg.PortRangeEnd - cfg.PortRangeStart + 1; need > have {
+		add("port_range_end", "%d ports from %d to %d, but up to %d loaded models need %d",
+			have, cfg.PortRangeStart, cfg.PortRangeEnd, len(portsPerModel), need)
+	}
+	if cfg.PortRangeEnd > 65535 {
+		add("port_range_end", "%d is beyond 65535", cfg.PortRangeEnd)
+	}
+
+	return errs
+}
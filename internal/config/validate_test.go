@@ -0,0 +1,130 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		yaml      string
+		wantField string // "" for a config without errors
+		wantLine  int
+		warning   bool
+		wantMsg   string
+	}{
+		{name: "valid", yaml: "llama_server_path: /bin/true\nmodels:\n  - {name: a, external_url: \"http://127.0.0.1:9\"}\n"},
+		{name: "missing llama_server_path", yaml: "models: []\n", wantField: "llama_server_path", wantMsg: "is required"},
+		{name: "duplicate model names", wantField: "models[1].name", wantMsg: "already used by models[0]", yaml: `llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9"}
+  - {name: a, external_url: "http://127.0.0.1:9"}
+`},
+		{name: "bad YAML", yaml: "llama_server_path: [unclosed\n", wantMsg: "parsing config"},
+		{name: "unknown field", yaml: "llama_server_path: /bin/true\nlisten_adr: \":8000\"\n",
+			wantField: "listen_adr", wantLine: 2, warning: true, wantMsg: "unknown field"},
+		{name: "missing LoRA file", wantField: "models[0].loras[0].path", warning: true, wantMsg: "no such file", yaml: `llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", loras: [{path: /nonexistent/adapter.gguf}]}
+`},
+		{name: "auto_download without token", wantField: "models[0].auto_download.token", warning: true, wantMsg: "not set", yaml: `llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", auto_download: {repo: org/repo, token_env_var: GATEWAY_TEST_UNSET_TOKEN}}
+`},
+		{name: "alias repeats name", wantField: "models[0].aliases[0]", warning: true, wantMsg: "repeats the model's own name", yaml: `llama_server_path: /bin/true
+models:
+  - {name: a, aliases: [a], external_url: "http://127.0.0.1:9"}
+`},
+		{name: "pattern shadowed by a model name", wantField: "models[0].alias_patterns[0]", warning: true, wantMsg: "matches the name of models[1]", yaml: `llama_server_path: /bin/true
+models:
+  - {name: a, alias_patterns: ["b.*"], external_url: "http://127.0.0.1:9"}
+  - {name: b1, external_url: "http://127.0.0.1:9"}
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateYAML([]byte(tt.yaml))
+			if tt.wantMsg == "" {
+				if len(errs) > 0 {
+					t.Fatalf("ValidateYAML = %+v, want no errors", errs)
+				}
+				return
+			}
+			for _, e := range errs {
+				if e.Field == tt.wantField && strings.Contains(e.Message, tt.wantMsg) {
+					if e.Warning != tt.warning {
+						t.Errorf("%s: warning = %v, want %v", e.Field, e.Warning, tt.warning)
+					}
+					if tt.wantLine != 0 && e.Line != tt.wantLine {
+						t.Errorf("%s: line = %d, want %d", e.Field, e.Line, tt.wantLine)
+					}
+					return
+				}
+			}
+			t.Errorf("ValidateYAML = %+v, want an error for %q containing %q", errs, tt.wantField, tt.wantMsg)
+		})
+	}
+}
+
+func TestValidatePortRange(t *testing.T) {
+	local := func(instances, maxInstances int) ModelConfig {
+		return ModelConfig{Name: "m", ModelPath: "validate.go", Instances: instances, MaxInstances: maxInstances}
+	}
+	tests := []struct {
+		name      string
+		start     int
+		end       int
+		maxLoaded int
+		models    []ModelConfig
+		wantErr   bool
+	}{
+		{name: "fits", start: 8081, end: 8082, maxLoaded: 2, models: []ModelConfig{local(1, 1), local(1, 1)}},
+		{name: "too small for instances", start: 8081, end: 8082, maxLoaded: 2, models: []ModelConfig{local(2, 2), local(1, 1)}, wantErr: true},
+		{name: "max_instances counts", start: 8081, end: 8083, maxLoaded: 1, models: []ModelConfig{local(1, 4)}, wantErr: true},
+		{name: "only max_loaded_models count", start: 8081, end: 8083, maxLoaded: 1, models: []ModelConfig{local(3, 3), local(2, 2), local(1, 1)}},
+		{name: "external models need no port", start: 8081, end: 8081, maxLoaded: 2, models: []ModelConfig{
+			local(1, 1), {Name: "ext", ExternalURLs: []string{"http://127.0.0.1:9"}, Instances: 1},
+		}},
+		{name: "end beyond 65535", start: 65535, end: 65536, maxLoaded: 1, models: []ModelConfig{local(1, 1)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{PortRangeStart: tt.start, PortRangeEnd: tt.end, MaxLoadedModels: tt.maxLoaded, Models: tt.models}
+			var portErrs []ValidationError
+			for _, e := range Validate(cfg) {
+				if e.Field == "port_range_end" {
+					portErrs = append(portErrs, e)
+				}
+			}
+			if got := len(portErrs) > 0; got != tt.wantErr {
+				t.Errorf("port_range_end errors = %v, want error: %v", portErrs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateYAMLReportsAllNameErrors(t *testing.T) {
+	errs := ValidateYAML([]byte(`llama_server_path: /bin/true
+models:
+  - {name: a, external_url: "http://127.0.0.1:9", alias_patterns: ["a-(.*"]}
+  - {name: a, external_url: "http://127.0.0.1:9"}
+  - {name: b, external_url: "http://127.0.0.1:9", aliases: [a], alias_patterns: ["b-[.*"]}
+  - {name: b, external_url: "http://127.0.0.1:9"}
+`))
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Field)
+	}
+	want := []string{
+		"models[0].alias_patterns[0]",
+		"models[2].alias_patterns[0]",
+		"models[1].name",
+		"models[3].name",
+		"models[2].aliases[0]",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("ValidateYAML fields = %v, want %v", got, want)
+	}
+}
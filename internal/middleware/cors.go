@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+// CORS returns middleware that applies the configured cross-origin policy.
+// Only origins matching AllowedOrigins get an Access-Control-Allow-Origin
+// header, which names the origin itself; an empty list or a "*" entry allows
+// any origin with a plain "*".
+func CORS(cfg config.CORSConfig) func(http.Handler) http.Handler {
+	allowAll := len(cfg.AllowedOrigins) == 0
+	origins := make(map[string]bool, len(cfg.AllowedOrigins))
+	var patterns []originPattern
+	for _, o := range cfg.AllowedOrigins {
+		o = strings.TrimSuffix(o, "/")
+		switch {
+		case o == "*":
+			allowAll = true
+		case strings.Contains(o, "*"):
+			prefix, suffix, _ := strings.Cut(o, "*")
+			patterns = append(patterns, originPattern{prefix, suffix})
+		default:
+			origins[o] = true
+		}
+	}
+
+	methods := "GET, POST, OPTIONS"
+	if len(cfg.AllowedMethods) > 0 {
+		methods = strings.Join(cfg.AllowedMethods, ", ")
+	}
+	headers := "Content-Type, Authorization, X-Request-Id, X-Model-Override"
+	if len(cfg.AllowedHeaders) > 0 {
+		headers = strings.Join(cfg.AllowedHeaders, ", ")
+	}
+
+	matches := func(origin string) bool {
+		if allowAll || origins[origin] {
+			return true
+		}
+		for _, p := range patterns {
+			if p.match(origin) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			allowed := origin != "" && matches(origin)
+			reflect := !allowAll || cfg.AllowCredentials
+
+			h := w.Header()
+			if reflect {
+				// The response differs by Origin, so caches must key on it
+				h.Add("Vary", "Origin")
+			}
+			if allowed {
+				if reflect {
+					h.Set("Access-Control-Allow-Origin", origin)
+				} else {
+					h.Set("Access-Control-Allow-Origin", "*")
+				}
+				if cfg.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+				h.Set("Access-Control-Allow-Methods", methods)
+				h.Set("Access-Control-Allow-Headers", headers)
+				if cfg.MaxAgeSec > 0 {
+					h.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAgeSec))
+				}
+			}
+
+			if r.Method == http.MethodOptions {
+				if origin != "" && !allowed {
+					w.WriteHeader(http.StatusForbidden)
+				} else {
+					w.WriteHeader(http.StatusOK)
+				}
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// originPattern is an allowed origin with a single "*" wildcard, such as
+// "https://*.example.com".
+type originPattern struct {
+	prefix, suffix string
+}
+
+func (p originPattern) match(origin string) bool {
+	if len(origin) <= len(p.prefix)+len(p.suffix) ||
+		!strings.HasPrefix(origin, p.prefix) || !strings.HasSuffix(origin, p.suffix) {
+		return false
+	}
+	// The wildcard covers subdomain labels only, never the scheme or port
+	wild := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return !strings.ContainsAny(wild, "/:")
+}
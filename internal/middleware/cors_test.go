@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+func TestOriginPatternMatch(t *testing.T) {
+	p := originPattern{prefix: "https://", suffix: ".example.com"}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},
+		{"https://.example.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.org", false},
+		{"https://evil.org/.example.com", false},
+		{"https://evil.org:443.example.com", false},
+		{"https://app.example.com:8443", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := p.match(tt.origin); got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORS(t *testing.T) {
+	restricted := config.CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.corp.example"}}
+	credentialed := config.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+
+	tests := []struct {
+		name      string
+		cfg       config.CORSConfig
+		method    string
+		origin    string
+		wantAllow string // Access-Control-Allow-Origin
+		wantCreds bool
+		wantVary  bool
+		wantCode  int
+	}{
+		{name: "default allows any", cfg: config.CORSConfig{}, origin: "https://x.test", wantAllow: "*", wantCode: 200},
+		{name: "listed origin reflected", cfg: restricted, origin: "https://app.example.com",
+			wantAllow: "https://app.example.com", wantVary: true, wantCode: 200},
+		{name: "wildcard origin reflected", cfg: restricted, origin: "https://dev.corp.example",
+			wantAllow: "https://dev.corp.example", wantVary: true, wantCode: 200},
+		{name: "denied origin", cfg: restricted, origin: "https://evil.test", wantVary: true, wantCode: 200},
+		{name: "denied preflight", cfg: restricted, method: http.MethodOptions, origin: "https://evil.test",
+			wantVary: true, wantCode: http.StatusForbidden},
+		{name: "allowed preflight", cfg: restricted, method: http.MethodOptions, origin: "https://app.example.com",
+			wantAllow: "https://app.example.com", wantVary: true, wantCode: http.StatusOK},
+		{name: "credentials reflect instead of *", cfg: credentialed, origin: "https://x.test",
+			wantAllow: "https://x.test", wantCreds: true, wantVary: true, wantCode: 200},
+		{name: "no origin", cfg: restricted, wantVary: true, wantCode: 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/v1/models", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			CORS(tt.cfg)(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantCode)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("Allow-Credentials = %v, want %v", got, tt.wantCreds)
+			}
+			if got := w.Header().Get("Vary") == "Origin"; got != tt.wantVary {
+				t.Errorf("Vary: Origin = %v, want %v", got, tt.wantVary)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+func TestGzip(t *testing.T) {
+	enabled := config.CompressionConfig{Enabled: true, MinSize: 100}
+	large := `{"data":"` + strings.Repeat("x", 200) + `"}`
+	small := `{"data":"x"}`
+
+	tests := []struct {
+		name           string
+		cfg            config.CompressionConfig
+		acceptEncoding string
+		body           string
+		wantGzip       bool
+	}{
+		{name: "large response", cfg: enabled, acceptEncoding: "gzip", body: large, wantGzip: true},
+		{name: "below min_size", cfg: enabled, acceptEncoding: "gzip", body: small},
+		{name: "exactly min_size", cfg: enabled, acceptEncoding: "gzip", body: large[:100], wantGzip: true},
+		{name: "client without gzip", cfg: enabled, acceptEncoding: "", body: large},
+		{name: "gzip refused with q=0", cfg: enabled, acceptEncoding: "gzip;q=0", body: large},
+		{name: "disabled", cfg: config.CompressionConfig{MinSize: 100}, acceptEncoding: "gzip", body: large},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Gzip(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				// Several writes, so buffering up to min_size is exercised
+				for i := 0; i < len(tt.body); i += 30 {
+					w.Write([]byte(tt.body[i:min(i+30, len(tt.body))]))
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("Content-Encoding = %q, want gzip %v", rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			body := rec.Body.String()
+			if gotGzip {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				b, err := io.ReadAll(zr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				body = string(b)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", ct)
+			}
+		})
+	}
+}
+
+func TestGzipStreamsSSEUncompressed(t *testing.T) {
+	release := make(chan struct{})
+	h := Gzip(config.CompressionConfig{Enabled: true, MinSize: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	defer close(release)
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ce := resp.Header.Get("Content-Encoding"); ce != "" {
+		t.Fatalf("Content-Encoding = %q, want an uncompressed stream", ce)
+	}
+
+	// The first event must arrive while the handler is still running
+	line := make(chan string, 1)
+	go func() {
+		s, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- s
+	}()
+	select {
+	case got := <-line:
+		if got != "data: first\n" {
+			t.Errorf("first line = %q, want %q", got, "data: first\n")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("flushed event not received before the handler returned")
+	}
+}
+
+func TestGzipFlushBeforeMinSize(t *testing.T) {
+	h := Gzip(config.CompressionConfig{Enabled: true, MinSize: 1024})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"partial":`))
+		w.(http.Flusher).Flush()
+		w.Write([]byte(strings.Repeat(" ", 2048) + `true}`))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("Content-Encoding = %q after an early flush, want none", ce)
+	}
+	if !rec.Flushed {
+		t.Error("flush was not passed through")
+	}
+	if !strings.HasPrefix(rec.Body.String(), `{"partial":`) || !strings.HasSuffix(rec.Body.String(), "true}") {
+		t.Errorf("body = %q, want the handler's output unchanged", rec.Body)
+	}
+}
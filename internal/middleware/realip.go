@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const ClientIPKey contextKey = "client_ip"
+
+// RealIP resolves the client's IP when the gateway sits behind reverse
+// proxies. X-Forwarded-For and X-Real-IP are only believed when the direct
+// peer is trusted; the resolved address is stored for ClientIP.
+func RealIP(isTrusted func(net.IP) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := peerIP(r)
+			if ip != nil && isTrusted(ip) {
+				ip = forwardedIP(r, ip, isTrusted)
+			}
+			if ip != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ClientIPKey, ip))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedIP walks X-Forwarded-For from the nearest hop outwards and returns
+// the first address that is not a trusted proxy. A client can prepend
+// anything to the header, so entries beyond that point are ignored.
+func forwardedIP(r *http.Request, peer net.IP, isTrusted func(net.IP) bool) net.IP {
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	if len(hops) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip
+		}
+		return peer
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		if !isTrusted(ip) {
+			break
+		}
+	}
+	return client
+}
+
+// ClientIP returns the request's client IP as resolved by RealIP, or the
+// direct peer's address if RealIP is not in the chain.
+func ClientIP(r *http.Request) net.IP {
+	if ip, ok := r.Context().Value(ClientIPKey).(net.IP); ok {
+		return ip
+	}
+	return peerIP(r)
+}
+
+func peerIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
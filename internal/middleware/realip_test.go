@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	isTrusted := func(ip net.IP) bool { return proxies.Contains(ip) }
+	peer := net.ParseIP("10.0.0.1")
+
+	tests := []struct {
+		name   string
+		xff    []string
+		realIP string
+		want   string
+	}{
+		{name: "no headers", want: "10.0.0.1"},
+		{name: "X-Real-IP", realIP: "203.0.113.7", want: "203.0.113.7"},
+		{name: "invalid X-Real-IP", realIP: "nonsense", want: "10.0.0.1"},
+		{name: "single hop", xff: []string{"203.0.113.7"}, want: "203.0.113.7"},
+		{name: "X-Forwarded-For beats X-Real-IP", xff: []string{"203.0.113.7"}, realIP: "198.51.100.1", want: "203.0.113.7"},
+		{name: "trusted hops skipped", xff: []string{"203.0.113.7, 10.0.0.5, 10.0.0.6"}, want: "203.0.113.7"},
+		{name: "spoofed entries before the client ignored", xff: []string{"1.2.3.4, 203.0.113.7, 10.0.0.5"}, want: "203.0.113.7"},
+		{name: "repeated headers", xff: []string{"1.2.3.4", "203.0.113.7"}, want: "203.0.113.7"},
+		{name: "garbage stops the walk", xff: []string{"203.0.113.7, bogus, 10.0.0.5"}, want: "10.0.0.5"},
+		{name: "only trusted hops", xff: []string{"10.0.0.5, 10.0.0.6"}, want: "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for _, h := range tt.xff {
+				r.Header.Add("X-Forwarded-For", h)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := forwardedIP(r, peer, isTrusted); !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("forwardedIP = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	_, proxies, _ := net.ParseCIDR("10.0.0.0/8")
+	isTrusted := func(ip net.IP) bool { return proxies.Contains(ip) }
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "spoofed header from untrusted peer", remote: "203.0.113.7:5000", xff: "1.2.3.4", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.0.0.1:5000", xff: "203.0.113.7", want: "203.0.113.7"},
+		{name: "multi-hop through trusted proxies", remote: "10.0.0.1:5000", xff: "1.2.3.4, 203.0.113.7, 10.0.0.9", want: "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got net.IP
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = ClientIP(r) })
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			RealIP(isTrusted)(next).ServeHTTP(httptest.NewRecorder(), r)
+			if !got.Equal(net.ParseIP(tt.want)) {
+				t.Errorf("ClientIP = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
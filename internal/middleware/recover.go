@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// recoverWriter notes whether the response has started, since a 500 can only
+// be sent before that.
+type recoverWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoverWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoverWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recoverWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Recover returns middleware that turns a panic in a handler into a logged
+// stack trace and an OpenAI-style 500 response. It should be the outermost
+// layer; the request ID is taken from the X-Request-Id response header set
+// further in.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverWriter{ResponseWriter: w}
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// Deliberate abort of the response; let net/http handle it quietly
+				panic(err)
+			}
+
+			reqID := w.Header().Get("X-Request-Id")
+			log.Printf("[http] panic serving %s %s [%s]: %v\n%s", r.Method, r.URL.Path, reqID, err, debug.Stack())
+
+			if rw.wroteHeader {
+				// Too late for an error status; the client sees a truncated response
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{
+					"message": "internal server error",
+					"type":    "server_error",
+					"code":    "internal_error",
+				},
+			})
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
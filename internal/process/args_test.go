@@ -0,0 +1,56 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+// flagValue returns the argument following flag in args, or "" if absent.
+func flagValue(args []string, flag string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestBackendArgsParallel(t *testing.T) {
+	tests := []struct {
+		name         string
+		model        string // extra model-level YAML
+		wantCtx      string
+		wantParallel string
+	}{
+		{name: "defaults", wantCtx: "32768", wantParallel: "8"},
+		{name: "fewer slots", model: "    parallel_slots: 4\n", wantCtx: "16384", wantParallel: "4"},
+		{name: "context not scaled", model: "    parallel_slots: 4\n    scale_ctx_by_parallel: false\n",
+			wantCtx: "4096", wantParallel: "4"},
+		{name: "explicitly scaled", model: "    context_size: 8192\n    parallel_slots: 2\n    scale_ctx_by_parallel: true\n",
+			wantCtx: "16384", wantParallel: "2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			yaml := "llama_server_path: /bin/true\nmodels:\n  - name: m\n    model_path: m.gguf\n" + tt.model
+			if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := config.Load(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args := (&Backend{Model: cfg.Models[0], Port: 9000}).args()
+			if got := flagValue(args, "--ctx-size"); got != tt.wantCtx {
+				t.Errorf("--ctx-size = %s, want %s", got, tt.wantCtx)
+			}
+			if got := flagValue(args, "--parallel"); got != tt.wantParallel {
+				t.Errorf("--parallel = %s, want %s", got, tt.wantParallel)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+// DownloadStatus reports the progress of a model auto-download.
+type DownloadStatus struct {
+	Model      string    `json:"model"`
+	File       string    `json:"file"`
+	State      string    `json:"state"` // "downloading", "verifying", "done", "failed"
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"` // 0 if the server did not report a size
+	Pct        float64   `json:"pct"`
+	SpeedBps   float64   `json:"speed_bps"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// download tracks one model's transfer. Concurrent EnsureModel calls for the
+// same model wait on done instead of starting a second transfer.
+type download struct {
+	mu      sync.Mutex
+	status  DownloadStatus
+	resumed int64 // bytes already on disk when this attempt started
+	done    chan struct{}
+	err     error
+}
+
+func (d *download) update(fn func(s *DownloadStatus)) {
+	d.mu.Lock()
+	fn(&d.status)
+	d.status.UpdatedAt = time.Now()
+	d.mu.Unlock()
+}
+
+// progressWriter counts bytes written into the download's status.
+type progressWriter struct {
+	d *download
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	p.d.update(func(s *DownloadStatus) {
+		s.BytesDone += int64(len(b))
+		if s.BytesTotal > 0 {
+			s.Pct = float64(s.BytesDone) / float64(s.BytesTotal) * 100
+		}
+		if elapsed := time.Since(s.StartedAt).Seconds(); elapsed > 0 {
+			s.SpeedBps = float64(s.BytesDone-p.d.resumed) / elapsed
+		}
+	})
+	return len(b), nil
+}
+
+var huggingFaceURL = "https://huggingface.co"
+
+var downloadClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 60 * time.Second,
+	},
+}
+
+// GetDownloadStatus returns the progress of the model's most recent
+// auto-download, if any.
+func (m *Manager) GetDownloadStatus(model string) (DownloadStatus, bool) {
+	m.downloadsMu.Lock()
+	d, ok := m.downloads[model]
+	m.downloadsMu.Unlock()
+	if !ok {
+		return DownloadStatus{}, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.status, true
+}
+
+// --- Auto Download ---
+
+func (m *Manager) autoDownloadModel(modelCfg *config.ModelConfig) error {
+	ad := modelCfg.AutoDownload
+	if ad == nil {
+		return fmt.Errorf("no auto_download config")
+	}
+
+	localDir := ad.LocalDir
+	if localDir == "" {
+		localDir = filepath.Join(os.Getenv("HOME"), "models")
+	}
+
+	destPath := filepath.Join(localDir, ad.File)
+
+	if _, err := os.Stat(destPath); err == nil {
+		log.Printf("[download] %s already exists at %s", ad.File, destPath)
+		modelCfg.ModelPath = destPath
+		return nil
+	}
+
+	m.downloadsMu.Lock()
+	d, ok := m.downloads[modelCfg.Name]
+	if ok {
+		select {
+		case <-d.done:
+			ok = false // previous attempt finished; start a new one
+		default:
+		}
+	}
+	if !ok {
+		d = &download{
+			status: DownloadStatus{Model: modelCfg.Name, File: ad.File, State: "downloading", StartedAt: time.Now()},
+			done:   make(chan struct{}),
+		}
+		m.downloads[modelCfg.Name] = d
+	}
+	m.downloadsMu.Unlock()
+
+	if ok {
+		log.Printf("[download] Waiting for in-progress download of %s", ad.File)
+		<-d.done
+		if d.err == nil {
+			modelCfg.ModelPath = destPath
+		}
+		return d.err
+	}
+
+	d.err = m.fetchModel(d, ad, localDir, destPath)
+	if d.err != nil {
+		d.update(func(s *DownloadStatus) { s.State = "failed"; s.Error = d.err.Error() })
+		log.Printf("[download] download_failed: %s: %v", ad.File, d.err)
+	} else {
+		d.update(func(s *DownloadStatus) { s.State = "done" })
+		modelCfg.ModelPath = destPath
+		log.Printf("[download] download_finished: %s", ad.File)
+	}
+	close(d.done)
+	return d.err
+}
+
+// fetchModel downloads the file to destPath+".partial", resuming from any
+// existing partial file with an HTTP Range request, verifies the optional
+// checksum and renames it into place.
+func (m *Manager) fetchModel(d *download, ad *config.AutoDownloadConfig, localDir, destPath string) error {
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("creating dir %s: %w", localDir, err)
+	}
+
+	url := fmt.Sprintf("%s/%s/resolve/main/%s", huggingFaceURL, ad.Repo, ad.File)
+	partPath := destPath + ".partial"
+
+	var offset int64
+	if fi, err := os.Stat(partPath); err == nil {
+		offset = fi.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	token := ad.ResolveToken()
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	if token != "" {
+		log.Printf("[download] download_started: %s to %s (token %s, resume at %d bytes)", url, destPath, maskToken(token), offset)
+	} else {
+		log.Printf("[download] download_started: %s to %s (resume at %d bytes)", url, destPath, offset)
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// Server ignored the Range header (or nothing to resume): start over
+		offset = 0
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete
+		return m.finishDownload(d, ad, partPath, destPath)
+	default:
+		return fmt.Errorf("download failed: %s returned %s", url, resp.Status)
+	}
+
+	d.update(func(s *DownloadStatus) {
+		s.BytesDone = offset
+		if resp.ContentLength >= 0 {
+			s.BytesTotal = offset + resp.ContentLength
+		}
+	})
+	d.resumed = offset
+
+	f, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	_, copyErr := io.Copy(io.MultiWriter(f, progressWriter{d}), resp.Body)
+	closeErr := f.Close()
+	if copyErr != nil {
+		// Keep the partial file so the next attempt can resume
+		return fmt.Errorf("download interrupted: %w", copyErr)
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return m.finishDownload(d, ad, partPath, destPath)
+}
+
+// finishDownload verifies the optional checksum of a complete partial file
+// and moves it into place.
+func (m *Manager) finishDownload(d *download, ad *config.AutoDownloadConfig, partPath, destPath string) error {
+	if ad.SHA256 != "" {
+		d.update(func(s *DownloadStatus) { s.State = "verifying" })
+		if err := verifySHA256(partPath, ad.SHA256); err != nil {
+			os.Remove(partPath)
+			return err
+		}
+		log.Printf("[download] download_verified: %s matches sha256 %s", ad.File, ad.SHA256)
+	}
+
+	return os.Rename(partPath, destPath)
+}
+
+// verifySHA256 streams the file through SHA-256 and compares it against the
+// expected hex digest.
+func verifySHA256(path, expected string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+	actual := hex.EncodeToString(h.Sum(nil))
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", filepath.Base(path), expected, actual)
+	}
+	return nil
+}
+
+// maskToken hides all but the last four characters of a secret for logging.
+func maskToken(token string) string {
+	if len(token) <= 4 {
+		return "****"
+	}
+	return "****" + token[len(token)-4:]
+}
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+// fakeHub serves content as org/repo's model.gguf with Range support and
+// returns the Range headers it has seen. If interruptAfter > 0, the first
+// response is cut off after that many bytes.
+func fakeHub(t *testing.T, content []byte, interruptAfter int) (ranges func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/org/repo/resolve/main/model.gguf" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Range"))
+		first := len(seen) == 1
+		mu.Unlock()
+		if first && interruptAfter > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			w.Write(content[:interruptAfter])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "model.gguf", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(srv.Close)
+
+	orig := huggingFaceURL
+	huggingFaceURL = srv.URL
+	t.Cleanup(func() { huggingFaceURL = orig })
+
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func downloadModel(dir, sha string) *config.ModelConfig {
+	return &config.ModelConfig{
+		Name: "m",
+		AutoDownload: &config.AutoDownloadConfig{
+			Repo: "org/repo", File: "model.gguf", LocalDir: dir, SHA256: sha,
+		},
+	}
+}
+
+func TestFetchModelResumes(t *testing.T) {
+	content := bytes.Repeat([]byte("gguf"), 4096)
+	sum := sha256.Sum256(content)
+	ranges := fakeHub(t, content, len(content)/2)
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "model.gguf")
+	m := NewManager(&config.Config{})
+	mc := downloadModel(dir, hex.EncodeToString(sum[:]))
+
+	err := m.autoDownloadModel(mc)
+	if err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("first attempt: err = %v, want an interrupted download", err)
+	}
+	if fi, err := os.Stat(dest + ".partial"); err != nil || fi.Size() != int64(len(content)/2) {
+		t.Fatalf("partial file after interruption: %v, %v; want %d bytes", fi, err, len(content)/2)
+	}
+
+	if err := m.autoDownloadModel(mc); err != nil {
+		t.Fatalf("resumed attempt: %v", err)
+	}
+	if got := ranges(); len(got) != 2 || got[0] != "" || got[1] != "bytes=8192-" {
+		t.Errorf("Range headers = %q, want none then bytes=8192-", got)
+	}
+	got, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("downloaded %d bytes that differ from the %d served", len(got), len(content))
+	}
+	if _, err := os.Stat(dest + ".partial"); !os.IsNotExist(err) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+	if mc.ModelPath != dest {
+		t.Errorf("ModelPath = %q, want %q", mc.ModelPath, dest)
+	}
+	st, _ := m.GetDownloadStatus("m")
+	if st.State != "done" || st.BytesDone != int64(len(content)) || st.BytesTotal != int64(len(content)) {
+		t.Errorf("status = %s %d/%d, want done %d/%d", st.State, st.BytesDone, st.BytesTotal, len(content), len(content))
+	}
+}
+
+func TestFetchModelChecksumMismatch(t *testing.T) {
+	content := bytes.Repeat([]byte("gguf"), 1024)
+	fakeHub(t, content, 0)
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "model.gguf")
+	m := NewManager(&config.Config{})
+	mc := downloadModel(dir, strings.Repeat("0", 64))
+
+	err := m.autoDownloadModel(mc)
+	if err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("err = %v, want a sha256 mismatch", err)
+	}
+	for _, p := range []string{dest, dest + ".partial"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s exists after a checksum mismatch (%v)", filepath.Base(p), err)
+		}
+	}
+	if mc.ModelPath != "" {
+		t.Errorf("ModelPath = %q, want it unset", mc.ModelPath)
+	}
+	if st, _ := m.GetDownloadStatus("m"); st.State != "failed" {
+		t.Errorf("state = %q, want failed", st.State)
+	}
+}
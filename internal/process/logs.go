@@ -0,0 +1,122 @@
+package process
+
+import (
+	"bytes"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const backendLogLines = 500
+
+// LogLine is one line of llama-server output.
+type LogLine struct {
+	Time     time.Time `json:"time"`
+	Instance int       `json:"instance"`
+	Stream   string    `json:"stream"` // "stdout" or "stderr"
+	Text     string    `json:"text"`
+}
+
+// logBuffer keeps the most recent backendLogLines lines of a backend's output.
+type logBuffer struct {
+	mu    sync.Mutex
+	lines []LogLine
+	next  int
+	full  bool
+}
+
+func newLogBuffer() *logBuffer {
+	return &logBuffer{lines: make([]LogLine, backendLogLines)}
+}
+
+func (lb *logBuffer) add(line LogLine) {
+	lb.mu.Lock()
+	lb.lines[lb.next] = line
+	lb.next = (lb.next + 1) % len(lb.lines)
+	if lb.next == 0 {
+		lb.full = true
+	}
+	lb.mu.Unlock()
+}
+
+// tail returns up to n of the most recent lines, oldest first.
+func (lb *logBuffer) tail(n int) []LogLine {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	count := lb.next
+	if lb.full {
+		count = len(lb.lines)
+	}
+	if n <= 0 || n > count {
+		n = count
+	}
+	out := make([]LogLine, 0, n)
+	for i := count - n; i < count; i++ {
+		idx := i
+		if lb.full {
+			idx = (lb.next + i) % len(lb.lines)
+		}
+		out = append(out, lb.lines[idx])
+	}
+	return out
+}
+
+// lineWriter splits a process output stream into lines, records them in the
+// backend's logBuffer and echoes them to the gateway log tagged with the
+// model and instance.
+type lineWriter struct {
+	buf      *logBuffer
+	model    string
+	instance int
+	stream   string
+	partial  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		text := string(bytes.TrimRight(w.partial[:i], "\r"))
+		w.partial = w.partial[i+1:]
+		w.buf.add(LogLine{Time: time.Now(), Instance: w.instance, Stream: w.stream, Text: text})
+		log.Printf("[%s#%d] %s", w.model, w.instance, text)
+	}
+	// A line without a newline is kept until more output arrives; cap it so
+	// a runaway line cannot grow without bound.
+	if len(w.partial) > 64*1024 {
+		w.partial = w.partial[:0]
+	}
+	return len(p), nil
+}
+
+// GetBackendLogs returns up to n recent output lines for a loaded model. With
+// instance < 0, lines from all instances are merged in time order.
+func (m *Manager) GetBackendLogs(model string, instance, n int) []LogLine {
+	m.mu.Lock()
+	var bufs []*logBuffer
+	if mb, ok := m.backends[model]; ok {
+		for _, b := range mb.backends {
+			if b.logs != nil && (instance < 0 || b.instanceIdx == instance) {
+				bufs = append(bufs, b.logs)
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	var lines []LogLine
+	for _, lb := range bufs {
+		lines = append(lines, lb.tail(n)...)
+	}
+	if len(bufs) > 1 {
+		sort.SliceStable(lines, func(i, j int) bool { return lines[i].Time.Before(lines[j].Time) })
+	}
+	if n > 0 && len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return lines
+}
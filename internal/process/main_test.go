@@ -0,0 +1,112 @@
+package process
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+// fakeServerEnv makes the test binary act as llama-server when the manager
+// runs it, so tests can start, restart and drain real processes.
+const fakeServerEnv = "FAKE_LLAMA_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		fakeLlamaServer(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// fakeLlamaServer serves /health and a chat completion endpoint that takes
+// as long as its X-Fake-Delay header says.
+func fakeLlamaServer(args []string) {
+	fs := flag.NewFlagSet("llama-server", flag.ContinueOnError)
+	port := fs.Int("port", 0, "")
+	fs.String("model", "", "")
+	fs.String("host", "", "")
+	fs.Parse(argsWithValues(args, "--port", "--model", "--host"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"ok"}`)
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		if d, err := time.ParseDuration(r.Header.Get("X-Fake-Delay")); err == nil {
+			time.Sleep(d)
+		}
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}],"usage":{"completion_tokens":1}}`)
+	})
+	if err := http.ListenAndServe("127.0.0.1:"+strconv.Itoa(*port), mux); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// argsWithValues picks the given flags and their values out of a full
+// llama-server command line, dropping the ones the fake does not know.
+func argsWithValues(args []string, keep ...string) []string {
+	var out []string
+	for i := 0; i+1 < len(args); i++ {
+		for _, k := range keep {
+			if args[i] == k {
+				out = append(out, args[i], args[i+1])
+				i++
+				break
+			}
+		}
+	}
+	return out
+}
+
+// fakeServerConfig loads a config whose llama_server_path is the fake server;
+// model is extra model-level YAML for model "m".
+func fakeServerConfig(t *testing.T, global, model string) *config.Config {
+	t.Helper()
+	t.Setenv(fakeServerEnv, "1")
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := freePort(t)
+	yaml := fmt.Sprintf("llama_server_path: %s\nport_range_start: %d\nport_range_end: %d\n%s"+
+		"models:\n  - name: m\n    model_path: m.gguf\n    startup_timeout_sec: 10\n%s",
+		exe, start, start+50, global, model)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// fakeChat sends a chat completion to b the way the API handler does,
+// holding an active request slot while the fake takes delay to answer.
+func fakeChat(m *Manager, b *Backend, delay time.Duration) error {
+	b.IncrActiveReqs()
+	defer m.ReleaseBackend(b)
+	req, err := http.NewRequest(http.MethodPost, b.URL()+"/v1/chat/completions", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Fake-Delay", delay.String())
+	resp, err := b.HTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
@@ -2,13 +2,18 @@ package process
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -23,9 +28,46 @@ const (
 	StateStarting
 	StateReady
 	StateFailed
+	StateDraining // finishing in-flight requests before stopping; gets no new ones
 )
 
-const maxAutoRestarts = 5
+const (
+	maxRestartBackoff = 60 * time.Second
+	crashLoopWindow   = 2 * time.Minute // uptime after which the crash count resets
+	drainTimeout      = 60 * time.Second
+	drainGrace        = 500 * time.Millisecond
+	healthTimeout     = 10 * time.Second // per health probe, so one hung host cannot stall the rest
+)
+
+// InternalHeader marks backend calls that originate from the gateway itself
+// (readiness polls, health checks) rather than from clients.
+const InternalHeader = "X-Llamawrapper-Internal"
+
+const maxInternalReqs = 1 // concurrent gateway-originated calls per backend
+
+// ErrBackendsUnhealthy is returned for an external model whose backends have
+// all failed their health checks.
+var ErrBackendsUnhealthy = errors.New("backends are failing health checks")
+
+// ErrAllSlotsPinned is returned when every loaded model is pinned, so nothing
+// can be evicted to make room.
+var ErrAllSlotsPinned = errors.New("all model slots are held by pinned models")
+
+// ErrQueueFlushed is delivered to queued requests removed by FlushQueue.
+var ErrQueueFlushed = errors.New("queue flushed by admin")
+
+// ErrModelDraining is returned for requests to a model that is being drained.
+var ErrModelDraining = errors.New("model is draining")
+
+// ErrStartupTimeout is returned when a backend does not pass its readiness
+// check within the model's startup_timeout_sec.
+var ErrStartupTimeout = errors.New("backend startup timed out")
+
+// ErrQueueTimeout is returned when a queued request does not get a model slot
+// within the queue's timeout_sec.
+var ErrQueueTimeout = errors.New("queue timeout")
+
+var errInternalDeferred = fmt.Errorf("internal request deferred: backend busy")
 
 type Backend struct {
 	Model        config.ModelConfig
@@ -33,81 +75,328 @@ type Backend struct {
 	State        BackendState
 	Process      *exec.Cmd
 	LastUsed     time.Time
+	startedAt    time.Time // when the current process was launched
 	cancel       context.CancelFunc
 	ActiveReqs   int64 // atomic: number of in-flight requests
+	internalReqs int64 // atomic: number of in-flight gateway-originated requests
 	instanceIdx  int
-	restartCount int
+	restartCount int  // consecutive crashes
+	crashLooped  bool // gave up restarting; cleared by config reload
+	logs         *logBuffer
+	externalURL  string // set for backends the gateway does not manage
+	clientOnce   sync.Once
+	client       *http.Client
 }
 
 func (b *Backend) URL() string {
+	if b.externalURL != "" {
+		return b.externalURL
+	}
+	if b.Model.UseUnixSocket {
+		// The host is ignored: HTTPClient dials the socket directly
+		return "http://unix"
+	}
 	return fmt.Sprintf("http://127.0.0.1:%d", b.Port)
 }
 
-func (b *Backend) IncrActiveReqs() { atomic.AddInt64(&b.ActiveReqs, 1) }
-func (b *Backend) DecrActiveReqs() { atomic.AddInt64(&b.ActiveReqs, -1) }
+// SocketPath returns the Unix socket the backend listens on, or "" for TCP.
+// The port is still allocated and keeps socket names unique.
+func (b *Backend) SocketPath() string {
+	if !b.Model.UseUnixSocket || b.External() {
+		return ""
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, b.Model.Name)
+	return filepath.Join(os.TempDir(), fmt.Sprintf("llama-%s-%d.sock", name, b.Port))
+}
+
+// HTTPClient returns the client to use for requests to URL(). Unix-socket
+// backends get a dedicated transport that dials the socket.
+func (b *Backend) HTTPClient() *http.Client {
+	sock := b.SocketPath()
+	if sock == "" {
+		return http.DefaultClient
+	}
+	b.clientOnce.Do(func() {
+		b.client = &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", sock)
+				},
+				MaxIdleConnsPerHost: 16,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		}
+	})
+	return b.client
+}
+
+// External reports whether the backend is a remote llama-server whose
+// lifecycle is managed outside the gateway.
+func (b *Backend) External() bool { return b.externalURL != "" }
+
+func (b *Backend) IncrActiveReqs()      { atomic.AddInt64(&b.ActiveReqs, 1) }
+func (b *Backend) DecrActiveReqs()      { atomic.AddInt64(&b.ActiveReqs, -1) }
 func (b *Backend) GetActiveReqs() int64 { return atomic.LoadInt64(&b.ActiveReqs) }
 
+// internalRequest sends a gateway-originated request to the backend. It is
+// tagged with InternalHeader, limited to maxInternalReqs concurrent calls per
+// backend, and deferred (errInternalDeferred) while client traffic is heavy so
+// it never takes the last free slot.
+func (b *Backend) internalRequest(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	// Leave at least one slot for clients
+	if b.GetActiveReqs() >= int64(max(b.Model.ParallelSlots-1, 1)) {
+		return nil, errInternalDeferred
+	}
+	return b.sendInternal(ctx, method, path, body)
+}
+
+// probe sends a health or readiness check. Unlike internalRequest it is not
+// deferred under client load, which would keep a backend that is wedged
+// while holding requests from ever failing its check; it still counts
+// against maxInternalReqs.
+func (b *Backend) probe(ctx context.Context, path string) (*http.Response, error) {
+	return b.sendInternal(ctx, http.MethodGet, path, nil)
+}
+
+func (b *Backend) sendInternal(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	if atomic.AddInt64(&b.internalReqs, 1) > maxInternalReqs {
+		atomic.AddInt64(&b.internalReqs, -1)
+		return nil, errInternalDeferred
+	}
+	defer atomic.AddInt64(&b.internalReqs, -1)
+
+	req, err := http.NewRequestWithContext(ctx, method, b.URL()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(InternalHeader, "1")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return b.HTTPClient().Do(req)
+}
+
 // modelBackends holds one or more backends for a single model (load balancing).
 type modelBackends struct {
 	backends []*Backend
 	rrIdx    uint64 // round-robin index (atomic)
+	stale    bool   // config changed on reload; restart on next request
+
+	// Dynamic scaling state, guarded by Manager.mu
+	busySamples int       // consecutive samples at or above the scale-up threshold
+	lastBusy    time.Time // last sample with any in-flight request
+	lastScaled  time.Time
+	scaling     bool // a scale operation is in progress
 }
 
 // QueueEntry represents a queued request waiting for a model slot.
 type QueueEntry struct {
+	ID        string // set for asynchronous requests, see WithQueueID
 	ModelName string
 	Ready     chan *Backend
 	Err       chan error
 	ctx       context.Context
+	queuedAt  time.Time
 }
 
 type Manager struct {
 	mu              sync.Mutex
 	cfg             *config.Config
 	backends        map[string]*modelBackends
-	nextPort        int
-	freedPorts      []int
+	ports           map[int]*Backend // ports held by local backends
+	portStart       int
+	portEnd         int
 	maxLoaded       int
 	llamaServerPath string
 
+	// Previous CPU samples for GetProcessStats, by PID
+	cpuSamples map[int]cpuSample
+	statsMu    sync.Mutex
+
+	// Auto-downloads in progress or finished, by model name
+	downloads   map[string]*download
+	downloadsMu sync.Mutex
+
 	// Request queue
 	queue     []*QueueEntry
 	queueMu   sync.Mutex
 	queueCond *sync.Cond
+	queueWait time.Duration // moving average of time spent queued
+
+	// Maintenance mode, guarded by mu
+	maintenance    bool
+	maintenanceMsg string
 }
 
 func NewManager(cfg *config.Config) *Manager {
 	m := &Manager{
 		cfg:             cfg,
 		backends:        make(map[string]*modelBackends),
-		nextPort:        cfg.PortRangeStart,
+		downloads:       make(map[string]*download),
+		ports:           make(map[int]*Backend),
+		portStart:       cfg.PortRangeStart,
+		portEnd:         cfg.PortRangeEnd,
 		maxLoaded:       cfg.MaxLoadedModels,
 		llamaServerPath: cfg.LlamaServerPath,
 	}
 	m.queueCond = sync.NewCond(&m.queueMu)
+	if cfg.Maintenance.Enabled {
+		m.setMaintenanceLocked(true, cfg.Maintenance.Message)
+	}
 	return m
 }
 
-// allocPort returns a recycled port or the next sequential port. Must be called with m.mu held.
-func (m *Manager) allocPort() int {
-	if len(m.freedPorts) > 0 {
-		port := m.freedPorts[len(m.freedPorts)-1]
-		m.freedPorts = m.freedPorts[:len(m.freedPorts)-1]
-		return port
+// allocPort assigns b the lowest port in the configured range that no other
+// backend holds and that nothing else is listening on, so ports of stopped
+// backends are reused first. Must be called with m.mu held.
+func (m *Manager) allocPort(b *Backend) error {
+	end := m.portEnd
+	if end < m.portStart {
+		end = m.portStart + 999
+	}
+	for port := m.portStart; port <= end; port++ {
+		if _, held := m.ports[port]; held {
+			continue
+		}
+		if !portAvailable(port) {
+			log.Printf("[process] Port %d is in use by another process, skipping", port)
+			continue
+		}
+		m.ports[port] = b
+		b.Port = port
+		return nil
+	}
+	return fmt.Errorf("no free ports in range %d-%d (raise port_range_end or unload models)", m.portStart, end)
+}
+
+// releasePort returns b's port to the pool. Must be called with m.mu held.
+func (m *Manager) releasePort(b *Backend) {
+	if m.ports[b.Port] == b {
+		delete(m.ports, b.Port)
 	}
-	port := m.nextPort
-	m.nextPort++
-	return port
 }
 
-// UpdateConfig replaces the running config (hot reload).
-func (m *Manager) UpdateConfig(cfg *config.Config) {
+// portAvailable probes whether a port can be bound on localhost.
+func portAvailable(port int) bool {
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
+
+// ReloadSummary describes what a config reload did to loaded models.
+type ReloadSummary struct {
+	Removed   []string `json:"removed"`   // no longer configured; drained and stopped
+	Changed   []string `json:"changed"`   // launch settings differ; restarted gracefully
+	Unchanged []string `json:"unchanged"` // left running as is
+}
+
+// UpdateConfig replaces the running config (hot reload) and reconciles loaded
+// models with it. Models removed from the config are drained and stopped.
+// Models whose launch settings changed are rolling-restarted, right away with
+// restart_on_reload or otherwise on their next request.
+func (m *Manager) UpdateConfig(cfg *config.Config) ReloadSummary {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if cfg.Maintenance != m.cfg.Maintenance {
+		m.setMaintenanceLocked(cfg.Maintenance.Enabled, cfg.Maintenance.Message)
+	}
 	m.cfg = cfg
 	m.maxLoaded = cfg.MaxLoadedModels
 	m.llamaServerPath = cfg.LlamaServerPath
-	log.Printf("[process] Config reloaded: %d models, max loaded: %d", len(cfg.Models), cfg.MaxLoadedModels)
+	m.portStart = cfg.PortRangeStart
+	m.portEnd = cfg.PortRangeEnd
+
+	var summary ReloadSummary
+	for name, mb := range m.backends {
+		mc := m.modelConfig(name)
+		if mc == nil {
+			log.Printf("[process] reload: %s removed from config, draining and stopping", name)
+			delete(m.backends, name)
+			for _, b := range mb.backends {
+				go m.drainAndStop(b)
+			}
+			summary.Removed = append(summary.Removed, name)
+			continue
+		}
+		if len(mb.backends) > 0 && mb.backends[0].External() {
+			// Re-registered from the new external URLs on next use
+			m.stopModel(name)
+			summary.Changed = append(summary.Changed, name)
+			continue
+		}
+
+		// A reload is the operator's signal to retry crash-looping models
+		crashLooped := false
+		for _, b := range mb.backends {
+			if b.crashLooped {
+				crashLooped = true
+				break
+			}
+		}
+		if crashLooped {
+			log.Printf("[process] reload: clearing crash-loop state for %s", name)
+			m.stopModel(name)
+			summary.Changed = append(summary.Changed, name)
+			continue
+		}
+
+		if len(mb.backends) == 0 || launchSettingsEqual(mb.backends[0].Model, *mc) {
+			summary.Unchanged = append(summary.Unchanged, name)
+			continue
+		}
+		summary.Changed = append(summary.Changed, name)
+		if cfg.RestartOnReload {
+			log.Printf("[process] reload: %s settings changed, restarting now", name)
+			go m.RollingRestart(context.Background(), name)
+		} else {
+			log.Printf("[process] reload: %s settings changed, restarting on next request", name)
+			mb.stale = true
+		}
+	}
+	log.Printf("[process] Config reloaded: %d models, max loaded: %d (%d removed, %d changed, %d unchanged)",
+		len(cfg.Models), cfg.MaxLoadedModels, len(summary.Removed), len(summary.Changed), len(summary.Unchanged))
+	return summary
+}
+
+// launchSettingsEqual reports whether two model configs start llama-server
+// the same way.
+func launchSettingsEqual(a, b config.ModelConfig) bool {
+	ba, bb := Backend{Model: a}, Backend{Model: b}
+	return a.GPUDevices == b.GPUDevices && slices.Equal(ba.args(), bb.args())
+}
+
+// SetMaintenance turns maintenance mode on or off. While on, the API rejects
+// new inference requests with message; requests in flight are unaffected.
+func (m *Manager) SetMaintenance(enabled bool, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setMaintenanceLocked(enabled, message)
+}
+
+func (m *Manager) setMaintenanceLocked(enabled bool, message string) {
+	if enabled {
+		log.Printf("[process] Maintenance mode enabled: %q", message)
+	} else if m.maintenance {
+		log.Printf("[process] Maintenance mode disabled")
+	}
+	m.maintenance = enabled
+	m.maintenanceMsg = message
+}
+
+// Maintenance reports whether maintenance mode is on, and its message.
+func (m *Manager) Maintenance() (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.maintenance, m.maintenanceMsg
 }
 
 // GetConfig returns the current config.
@@ -117,12 +406,33 @@ func (m *Manager) GetConfig() *config.Config {
 	return m.cfg
 }
 
+// ReleaseBackend ends a request started on b after EnsureModel and
+// IncrActiveReqs. It refreshes LastUsed, so idle unload and LRU eviction
+// count from when the request finished rather than when it started.
+func (m *Manager) ReleaseBackend(b *Backend) {
+	m.mu.Lock()
+	b.LastUsed = time.Now()
+	m.mu.Unlock()
+	b.DecrActiveReqs()
+}
+
 // EnsureModel starts a model if not already running, performing LRU eviction if needed.
 func (m *Manager) EnsureModel(ctx context.Context, modelName string) (*Backend, error) {
 	m.mu.Lock()
 
 	// Check if already loaded — pick backend via round-robin
 	if mb, ok := m.backends[modelName]; ok {
+		if mb.stale {
+			// Settings changed on reload; keep serving while instances are replaced
+			mb.stale = false
+			go m.RollingRestart(context.Background(), modelName)
+		}
+		for _, b := range mb.backends {
+			if b.crashLooped {
+				m.mu.Unlock()
+				return nil, fmt.Errorf("model %q is crash-looping (restarted %d times); fix it and reload the config", modelName, b.restartCount-1)
+			}
+		}
 		for _, b := range mb.backends {
 			if b.State == StateReady {
 				b.LastUsed = time.Now()
@@ -142,21 +452,35 @@ func (m *Manager) EnsureModel(ctx context.Context, modelName string) (*Backend,
 				return m.waitForReady(ctx, b)
 			}
 		}
+		for _, b := range mb.backends {
+			if b.State == StateDraining {
+				m.mu.Unlock()
+				return nil, fmt.Errorf("%w: %s stops once its in-flight requests finish", ErrModelDraining, modelName)
+			}
+		}
 	}
 
 	// Find model config
-	var modelCfg *config.ModelConfig
-	for i := range m.cfg.Models {
-		if m.cfg.Models[i].Name == modelName {
-			modelCfg = &m.cfg.Models[i]
-			break
-		}
-	}
+	modelCfg := m.modelConfig(modelName)
 	if modelCfg == nil {
 		m.mu.Unlock()
 		return nil, fmt.Errorf("model %q not found in config", modelName)
 	}
 
+	if modelCfg.IsExternal() {
+		if mb, ok := m.backends[modelName]; ok {
+			// None is ready; HealthCheck puts them back once they answer again
+			m.mu.Unlock()
+			return nil, fmt.Errorf("%w: all %d external backend(s) of %s", ErrBackendsUnhealthy, len(mb.backends), modelName)
+		}
+		// Not registered yet, or dropped by a reload
+		mb := m.registerExternal(*modelCfg)
+		idx := atomic.AddUint64(&mb.rrIdx, 1) - 1
+		chosen := mb.backends[idx%uint64(len(mb.backends))]
+		m.mu.Unlock()
+		return chosen, nil
+	}
+
 	// Auto-download if needed
 	if modelCfg.ModelPath == "" && modelCfg.AutoDownload != nil {
 		m.mu.Unlock()
@@ -166,9 +490,18 @@ func (m *Manager) EnsureModel(ctx context.Context, modelName string) (*Backend,
 		m.mu.Lock()
 	}
 
+	// Clear out failed or stopped instances before starting fresh ones
+	if _, ok := m.backends[modelName]; ok {
+		m.stopModel(modelName)
+	}
+
 	// Evict if at capacity
 	if err := m.evictIfNeeded(); err != nil {
 		m.mu.Unlock()
+		if errors.Is(err, ErrAllSlotsPinned) {
+			// Pinned models are never evicted, so waiting in the queue cannot help
+			return nil, fmt.Errorf("cannot load %q: %w", modelName, err)
+		}
 		return m.enqueue(ctx, modelName)
 	}
 
@@ -180,14 +513,19 @@ func (m *Manager) EnsureModel(ctx context.Context, modelName string) (*Backend,
 	}
 
 	for i := 0; i < instances; i++ {
-		port := m.allocPort()
 		b := &Backend{
 			Model:       *modelCfg,
-			Port:        port,
 			State:       StateStarting,
 			LastUsed:    time.Now(),
 			instanceIdx: i,
 		}
+		if err := m.allocPort(b); err != nil {
+			for _, prev := range mb.backends {
+				m.releasePort(prev)
+			}
+			m.mu.Unlock()
+			return nil, fmt.Errorf("cannot start %q: %w", modelName, err)
+		}
 		mb.backends = append(mb.backends, b)
 	}
 	m.backends[modelName] = mb
@@ -205,6 +543,24 @@ func (m *Manager) EnsureModel(ctx context.Context, modelName string) (*Backend,
 	return m.waitForReady(ctx, mb.backends[0])
 }
 
+// registerExternal adds a ready backend for each of the model's external URLs.
+// Must be called with m.mu held.
+func (m *Manager) registerExternal(modelCfg config.ModelConfig) *modelBackends {
+	mb := &modelBackends{}
+	for i, u := range modelCfg.ExternalURLs {
+		mb.backends = append(mb.backends, &Backend{
+			Model:       modelCfg,
+			State:       StateReady,
+			LastUsed:    time.Now(),
+			instanceIdx: i,
+			externalURL: u,
+		})
+	}
+	m.backends[modelCfg.Name] = mb
+	log.Printf("[process] Registered %d external backend(s) for %s", len(mb.backends), modelCfg.Name)
+	return mb
+}
+
 func (m *Manager) getReadyBackends(mb *modelBackends) []*Backend {
 	var ready []*Backend
 	for _, b := range mb.backends {
@@ -215,19 +571,23 @@ func (m *Manager) getReadyBackends(mb *modelBackends) []*Backend {
 	return ready
 }
 
-func (m *Manager) startBackend(b *Backend) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	b.cancel = cancel
+// args builds the llama-server command line for this instance.
+func (b *Backend) args() []string {
+	host := "127.0.0.1"
+	if sock := b.SocketPath(); sock != "" {
+		// llama-server listens on a Unix socket when --host ends in .sock
+		host = sock
+	}
 
 	args := []string{
 		"--model", b.Model.ModelPath,
 		"--port", strconv.Itoa(b.Port),
-		"--host", "127.0.0.1",
-		"--ctx-size", strconv.Itoa(b.Model.ContextSize * 8),
+		"--host", host,
+		"--ctx-size", strconv.Itoa(b.Model.EffectiveContextSize()),
 		"--threads", strconv.Itoa(b.Model.Threads),
 		"--batch-size", strconv.Itoa(b.Model.BatchSize),
 		"--cont-batching",
-		"--parallel", "8",
+		"--parallel", strconv.Itoa(b.Model.ParallelSlots),
 		"--cache-reuse", "256",
 	}
 
@@ -235,11 +595,46 @@ func (m *Manager) startBackend(b *Backend) error {
 		args = append(args, "--n-gpu-layers", strconv.Itoa(b.Model.GPULayers))
 	}
 
-	args = append(args, b.Model.ExtraArgs...)
+	if b.Model.MMProjPath != "" {
+		args = append(args, "--mmproj", b.Model.MMProjPath)
+	}
+
+	if sp := b.Model.Speculative; sp != nil && sp.DraftModelPath != "" {
+		args = append(args, "--model-draft", sp.DraftModelPath)
+		if sp.DraftGPULayers != 0 {
+			args = append(args, "--gpu-layers-draft", strconv.Itoa(sp.DraftGPULayers))
+		}
+		if sp.NumDraft > 0 {
+			args = append(args, "--draft-max", strconv.Itoa(sp.NumDraft))
+		}
+	}
+
+	for _, lora := range b.Model.LoRAs {
+		if lora.Scale != 0 {
+			args = append(args, "--lora-scaled", lora.Path, strconv.FormatFloat(lora.Scale, 'g', -1, 64))
+		} else {
+			args = append(args, "--lora", lora.Path)
+		}
+	}
+
+	return append(args, b.Model.ExtraArgs...)
+}
+
+func (m *Manager) startBackend(b *Backend) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.cancel = cancel
+
+	if sock := b.SocketPath(); sock != "" {
+		os.Remove(sock)
+	}
+	args := b.args()
 
 	cmd := exec.CommandContext(ctx, m.llamaServerPath, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	if b.logs == nil {
+		b.logs = newLogBuffer() // kept across auto-restarts so crash output survives
+	}
+	cmd.Stdout = &lineWriter{buf: b.logs, model: b.Model.Name, instance: b.instanceIdx, stream: "stdout"}
+	cmd.Stderr = &lineWriter{buf: b.logs, model: b.Model.Name, instance: b.instanceIdx, stream: "stderr"}
 
 	serverDir := filepath.Dir(m.llamaServerPath)
 	env := os.Environ()
@@ -264,29 +659,51 @@ func (m *Manager) startBackend(b *Backend) error {
 
 	b.Process = cmd
 
-	// Monitor process in background — auto-restart on crash
+	startedAt := time.Now()
+	m.mu.Lock()
+	b.startedAt = startedAt
+	m.mu.Unlock()
+
+	// Monitor process in background — auto-restart on crash with backoff
 	go func() {
 		err := cmd.Wait()
 		m.mu.Lock()
 		if err != nil && ctx.Err() == nil {
+			// A process that stayed up for a while is not part of a crash loop
+			if time.Since(startedAt) > crashLoopWindow {
+				b.restartCount = 0
+			}
 			b.restartCount++
 			restartCount := b.restartCount
+			maxRestarts := m.cfg.MaxRestarts
 			log.Printf("[process] %s (instance %d) crashed: %v (restart %d/%d)",
-				b.Model.Name, b.instanceIdx, err, restartCount, maxAutoRestarts)
+				b.Model.Name, b.instanceIdx, err, restartCount, maxRestarts)
+			if b.State == StateDraining {
+				// It was about to be stopped anyway
+				b.State = StateStopped
+				b.Process = nil
+				m.mu.Unlock()
+				return
+			}
 			b.State = StateFailed
 			b.Process = nil
-			m.mu.Unlock()
 
-			if restartCount > maxAutoRestarts {
-				log.Printf("[process] %s (instance %d) exceeded max auto-restarts (%d), giving up",
-					b.Model.Name, b.instanceIdx, maxAutoRestarts)
+			if restartCount > maxRestarts {
+				b.crashLooped = true
+				m.mu.Unlock()
+				log.Printf("[process] crash_loop: %s (instance %d) exceeded max restarts (%d), giving up until reload",
+					b.Model.Name, b.instanceIdx, maxRestarts)
 				return
 			}
+			m.mu.Unlock()
 
-			time.Sleep(2 * time.Second)
+			delay := restartBackoff(restartCount)
+			log.Printf("[process] Restarting %s (instance %d) in %v", b.Model.Name, b.instanceIdx, delay)
+			time.Sleep(delay)
 			m.mu.Lock()
 			if b.State == StateFailed {
 				b.State = StateStarting
+				b.startedAt = time.Now()
 				m.mu.Unlock()
 				if restartErr := m.startBackend(b); restartErr != nil {
 					log.Printf("[process] Auto-restart failed for %s: %v", b.Model.Name, restartErr)
@@ -307,25 +724,67 @@ func (m *Manager) startBackend(b *Backend) error {
 	return nil
 }
 
+// restartBackoff returns the delay before the nth consecutive restart:
+// 2s, 4s, 8s, ... capped at maxRestartBackoff.
+func restartBackoff(n int) time.Duration {
+	d := 2 * time.Second
+	for i := 1; i < n && d < maxRestartBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxRestartBackoff)
+}
+
+// waitForReady polls the backend's readiness path until it answers 200. The
+// deadline is measured from process start so every waiter shares it; an
+// instance that misses it is killed and ErrStartupTimeout returned.
 func (m *Manager) waitForReady(ctx context.Context, b *Backend) (*Backend, error) {
-	healthURL := fmt.Sprintf("%s/health", b.URL())
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
-	timeout := time.After(120 * time.Second)
+	m.mu.Lock()
+	startTimeout := b.Model.StartupTimeout()
+	started := b.startedAt
+	if started.IsZero() {
+		started = time.Now() // process not launched yet
+	}
+	deadline := started.Add(startTimeout)
+	readinessPath := b.Model.ReadinessPath
+	m.mu.Unlock()
+	if readinessPath == "" {
+		readinessPath = "/health"
+	}
+
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-timeout:
-			return nil, fmt.Errorf("timeout waiting for %s to become ready", b.Model.Name)
+		case <-timeout.C:
+			m.mu.Lock()
+			if b.State == StateStarting {
+				log.Printf("[process] %s (instance %d) not ready after %v, stopping it",
+					b.Model.Name, b.instanceIdx, startTimeout)
+				b.State = StateFailed
+				if b.cancel != nil {
+					b.cancel()
+				}
+			}
+			m.mu.Unlock()
+			return nil, fmt.Errorf("%s not ready after %v: %w", b.Model.Name, startTimeout, ErrStartupTimeout)
 		case <-ticker.C:
-			if b.State == StateFailed {
+			m.mu.Lock()
+			state := b.State
+			m.mu.Unlock()
+			switch state {
+			case StateFailed:
 				return nil, fmt.Errorf("backend %s failed to start", b.Model.Name)
+			case StateDraining, StateStopped:
+				return nil, fmt.Errorf("%w: %s was drained or stopped while starting", ErrModelDraining, b.Model.Name)
 			}
 
-			resp, err := http.Get(healthURL)
+			resp, err := b.probe(ctx, readinessPath)
 			if err != nil {
 				continue
 			}
@@ -333,11 +792,22 @@ func (m *Manager) waitForReady(ctx context.Context, b *Backend) (*Backend, error
 
 			if resp.StatusCode == http.StatusOK {
 				m.mu.Lock()
+				if b.State == StateDraining || b.State == StateStopped {
+					m.mu.Unlock()
+					continue
+				}
+				// Several requests may wait on the same startup; only the
+				// first to see it ready announces it
+				first := b.State != StateReady
 				b.State = StateReady
-				b.restartCount = 0
 				m.mu.Unlock()
-				log.Printf("[process] %s (instance %d) is ready on port %d",
-					b.Model.Name, b.instanceIdx, b.Port)
+				if first {
+					log.Printf("[process] %s (instance %d) is ready on port %d",
+						b.Model.Name, b.instanceIdx, b.Port)
+					if len(b.Model.WarmupPrompts) > 0 {
+						go m.warmup(b, b.Model.WarmupPrompts)
+					}
+				}
 
 				m.drainQueue(b.Model.Name)
 
@@ -350,17 +820,21 @@ func (m *Manager) waitForReady(ctx context.Context, b *Backend) (*Backend, error
 // --- Request Queue ---
 
 func (m *Manager) enqueue(ctx context.Context, modelName string) (*Backend, error) {
+	qcfg := m.GetConfig().Queue
+
 	m.queueMu.Lock()
-	if len(m.queue) >= 100 {
+	if len(m.queue) >= qcfg.MaxSize {
 		m.queueMu.Unlock()
-		return nil, fmt.Errorf("request queue is full (%d/100)", len(m.queue))
+		return nil, fmt.Errorf("request queue is full (%d/%d)", len(m.queue), qcfg.MaxSize)
 	}
 
 	entry := &QueueEntry{
+		ID:        queueIDFrom(ctx),
 		ModelName: modelName,
 		Ready:     make(chan *Backend, 1),
 		Err:       make(chan error, 1),
 		ctx:       ctx,
+		queuedAt:  time.Now(),
 	}
 	m.queue = append(m.queue, entry)
 	pos := len(m.queue)
@@ -368,7 +842,7 @@ func (m *Manager) enqueue(ctx context.Context, modelName string) (*Backend, erro
 
 	log.Printf("[queue] Request for %s queued at position %d", modelName, pos)
 
-	timeout := 300 * time.Second
+	timeout := qcfg.Timeout()
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
 
@@ -382,7 +856,7 @@ func (m *Manager) enqueue(ctx context.Context, modelName string) (*Backend, erro
 		return nil, ctx.Err()
 	case <-timer.C:
 		m.removeFromQueue(entry)
-		return nil, fmt.Errorf("queue timeout after %v", timeout)
+		return nil, fmt.Errorf("%w after %v", ErrQueueTimeout, timeout)
 	}
 }
 
@@ -411,6 +885,7 @@ func (m *Manager) drainQueue(modelName string) {
 					chosen := ready[0]
 					chosen.LastUsed = time.Now()
 					m.mu.Unlock()
+					m.recordQueueWait(time.Since(entry.queuedAt))
 					entry.Ready <- chosen
 					continue
 				}
@@ -429,26 +904,147 @@ func (m *Manager) GetQueueLength() int {
 	return len(m.queue)
 }
 
-// --- Eviction ---
+// QueueItem describes one request waiting in the queue.
+type QueueItem struct {
+	Position int       `json:"position"` // 1-based
+	Model    string    `json:"model"`
+	ID       string    `json:"id,omitempty"` // set for asynchronous requests
+	QueuedAt time.Time `json:"queued_at"`
+	WaitSec  float64   `json:"wait_sec"`
+}
 
-func (m *Manager) evictIfNeeded() error {
-	loaded := 0
-	for _, mb := range m.backends {
+// ListQueue returns the queued requests in queue order.
+func (m *Manager) ListQueue() []QueueItem {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	items := make([]QueueItem, 0, len(m.queue))
+	for i, e := range m.queue {
+		items = append(items, QueueItem{
+			Position: i + 1,
+			Model:    e.ModelName,
+			ID:       e.ID,
+			QueuedAt: e.queuedAt,
+			WaitSec:  time.Since(e.queuedAt).Seconds(),
+		})
+	}
+	return items
+}
+
+// FlushQueue removes the queued requests for model (all of them if model is
+// empty), failing each with ErrQueueFlushed. It returns how many were removed.
+func (m *Manager) FlushQueue(model string) int {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	var remaining []*QueueEntry
+	flushed := 0
+	for _, e := range m.queue {
+		if model != "" && e.ModelName != model {
+			remaining = append(remaining, e)
+			continue
+		}
+		e.Err <- ErrQueueFlushed
+		flushed++
+	}
+	m.queue = remaining
+	return flushed
+}
+
+// defaultQueueWait is the per-position wait estimate before any queued
+// request has been served.
+const defaultQueueWait = 30 * time.Second
+
+// recordQueueWait folds a served entry's wait into the moving average. Must
+// be called with m.queueMu held.
+func (m *Manager) recordQueueWait(d time.Duration) {
+	if m.queueWait == 0 {
+		m.queueWait = d
+		return
+	}
+	m.queueWait = (m.queueWait*4 + d) / 5
+}
+
+// QueuePosition returns the 1-based position of the asynchronous request id
+// in the queue, or false if it is not (or no longer) queued.
+func (m *Manager) QueuePosition(id string) (int, bool) {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	for i, e := range m.queue {
+		if e.ID == id {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// EstimatedQueueWait estimates how long a request at the given queue
+// position will wait, from the average wait of recently served requests.
+func (m *Manager) EstimatedQueueWait(pos int) time.Duration {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+	per := m.queueWait
+	if per == 0 {
+		per = defaultQueueWait
+	}
+	return time.Duration(pos) * per
+}
+
+// AtCapacity reports whether a request for the model would have to wait in
+// the queue: the model has no running instances, no slot is free and every
+// loaded model is busy or starting.
+func (m *Manager) AtCapacity(modelName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mb, ok := m.backends[modelName]; ok {
 		for _, b := range mb.backends {
 			if b.State == StateReady || b.State == StateStarting {
-				loaded++
+				return false
 			}
 		}
 	}
+	if mc := m.modelConfig(modelName); mc == nil || mc.IsExternal() {
+		return false
+	}
+	if m.loadedCount() < m.maxLoaded {
+		return false
+	}
+	lru, _, unpinned := m.lruCandidate()
+	return lru == "" && unpinned
+}
+
+// --- Eviction ---
 
-	if loaded < m.maxLoaded {
+func (m *Manager) evictIfNeeded() error {
+	if m.loadedCount() < m.maxLoaded {
 		return nil
 	}
 
-	var lruName string
-	var lruTime time.Time
+	lruName, lruTime, unpinned := m.lruCandidate()
+	if lruName == "" {
+		if !unpinned {
+			return ErrAllSlotsPinned
+		}
+		return fmt.Errorf("no evictable models found (all busy or starting)")
+	}
+
+	log.Printf("[process] Evicting LRU model %s (last used: %s)", lruName, lruTime.Format(time.RFC3339))
+	return m.stopModel(lruName)
+}
+
+// lruCandidate finds the least recently used idle, unpinned model. unpinned
+// reports whether any unpinned model is loaded or starting at all. Must be
+// called with m.mu held.
+func (m *Manager) lruCandidate() (lruName string, lruTime time.Time, unpinned bool) {
 	for name, mb := range m.backends {
+		if m.isPinned(name) {
+			continue
+		}
 		for _, b := range mb.backends {
+			if b.External() {
+				continue
+			}
+			if b.State == StateReady || b.State == StateStarting || b.State == StateDraining {
+				unpinned = true
+			}
 			if b.State != StateReady {
 				continue
 			}
@@ -461,13 +1057,25 @@ func (m *Manager) evictIfNeeded() error {
 			}
 		}
 	}
+	return lruName, lruTime, unpinned
+}
 
-	if lruName == "" {
-		return fmt.Errorf("no evictable models found (all busy or starting)")
+// modelConfig returns the current config entry for name, or nil. Must be
+// called with m.mu held.
+func (m *Manager) modelConfig(name string) *config.ModelConfig {
+	for i := range m.cfg.Models {
+		if m.cfg.Models[i].Name == name {
+			return &m.cfg.Models[i]
+		}
 	}
+	return nil
+}
 
-	log.Printf("[process] Evicting LRU model %s (last used: %s)", lruName, lruTime.Format(time.RFC3339))
-	return m.stopModel(lruName)
+// isPinned reports whether the named model is pinned in the current config.
+// Must be called with m.mu held.
+func (m *Manager) isPinned(name string) bool {
+	mc := m.modelConfig(name)
+	return mc != nil && mc.Pinned
 }
 
 func (m *Manager) stopModel(name string) error {
@@ -477,11 +1085,7 @@ func (m *Manager) stopModel(name string) error {
 	}
 
 	for _, b := range mb.backends {
-		if b.cancel != nil {
-			b.cancel()
-		}
-		b.State = StateStopped
-		m.freedPorts = append(m.freedPorts, b.Port)
+		m.stopBackend(b)
 	}
 
 	delete(m.backends, name)
@@ -489,6 +1093,269 @@ func (m *Manager) stopModel(name string) error {
 	return nil
 }
 
+// stopBackend kills a single instance and recycles its port. Must be called
+// with m.mu held.
+func (m *Manager) stopBackend(b *Backend) {
+	b.State = StateStopped
+	if b.External() {
+		// Nothing to kill; the remote server keeps running
+		return
+	}
+	if b.cancel != nil {
+		b.cancel()
+	}
+	m.releasePort(b)
+}
+
+// --- Rolling Restart ---
+
+// RollingRestart replaces every instance of a loaded model one at a time. Each
+// replacement starts on a fresh port from the current config and must become
+// ready before the old instance stops receiving traffic; the old instance is
+// then drained (up to drainTimeout) and stopped.
+func (m *Manager) RollingRestart(ctx context.Context, modelName string) error {
+	m.mu.Lock()
+	mb, ok := m.backends[modelName]
+	if !ok {
+		m.mu.Unlock()
+		return fmt.Errorf("model %q is not loaded", modelName)
+	}
+	modelCfg := m.modelConfig(modelName)
+	if modelCfg == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("model %q not found in config", modelName)
+	}
+	if modelCfg.IsExternal() {
+		m.mu.Unlock()
+		return fmt.Errorf("model %q uses external backends and cannot be restarted by the gateway", modelName)
+	}
+	cfgCopy := *modelCfg
+	old := append([]*Backend(nil), mb.backends...)
+	m.mu.Unlock()
+
+	log.Printf("[process] Rolling restart of %s (%d instance(s))", modelName, len(old))
+	for _, ob := range old {
+		if err := m.replaceBackend(ctx, mb, ob, cfgCopy); err != nil {
+			return fmt.Errorf("rolling restart of %q: %w", modelName, err)
+		}
+	}
+	log.Printf("[process] Rolling restart of %s complete", modelName)
+	return nil
+}
+
+// HotSwap points a model at a new GGUF file without changing its name. Loaded
+// instances are replaced through the rolling-restart path so requests keep
+// flowing. If an instance fails to come up on the new file, the ones already
+// swapped are put back on the old file; the returned error says whether that
+// worked or which instances are left on the new file. The change lives only
+// in the running config; config.yaml is not touched, so the next reload
+// restores the on-disk path.
+func (m *Manager) HotSwap(ctx context.Context, modelName, newModelPath string) error {
+	fi, err := os.Stat(newModelPath)
+	if err != nil {
+		return fmt.Errorf("new model file: %w", err)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("new model file %s is a directory", newModelPath)
+	}
+
+	m.mu.Lock()
+	mc := m.modelConfig(modelName)
+	if mc == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("model %q not found in config", modelName)
+	}
+	oldPath := mc.ModelPath
+	m.setModelPath(modelName, newModelPath)
+	_, loaded := m.backends[modelName]
+	m.mu.Unlock()
+
+	log.Printf("[process] Hot-swapping %s: %s -> %s", modelName, oldPath, newModelPath)
+	if !loaded {
+		return nil
+	}
+
+	if err := m.RollingRestart(ctx, modelName); err != nil {
+		m.mu.Lock()
+		m.setModelPath(modelName, oldPath)
+		m.mu.Unlock()
+		if rbErr := m.revertSwapped(modelName, newModelPath); rbErr != nil {
+			return fmt.Errorf("hot-swap of %q: %w; rollback incomplete: %v", modelName, err, rbErr)
+		}
+		return fmt.Errorf("hot-swap of %q: %w; swapped instances rolled back to %s", modelName, err, oldPath)
+	}
+	return nil
+}
+
+// revertSwapped replaces the instances of a model still running swappedPath
+// with ones built from its current config, after a failed hot-swap.
+func (m *Manager) revertSwapped(modelName, swappedPath string) error {
+	m.mu.Lock()
+	mb, ok := m.backends[modelName]
+	modelCfg := m.modelConfig(modelName)
+	if !ok || modelCfg == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	cfgCopy := *modelCfg
+	var swapped []*Backend
+	for _, b := range mb.backends {
+		if b.Model.ModelPath == swappedPath {
+			swapped = append(swapped, b)
+		}
+	}
+	m.mu.Unlock()
+
+	for i, b := range swapped {
+		log.Printf("[process] Rolling back %s (instance %d) to %s", modelName, b.instanceIdx, cfgCopy.ModelPath)
+		// The caller's context may be what failed the swap; the rollback
+		// is bounded by the model's startup timeout instead
+		if err := m.replaceBackend(context.Background(), mb, b, cfgCopy); err != nil {
+			return fmt.Errorf("%d of %d swapped instance(s) still running %s: %w",
+				len(swapped)-i, len(swapped), swappedPath, err)
+		}
+	}
+	return nil
+}
+
+// setModelPath updates a model's path in the running config. The config is
+// copied rather than mutated so callers holding the previous *Config never
+// see a partial update. Must be called with m.mu held.
+func (m *Manager) setModelPath(modelName, path string) {
+	cfg := *m.cfg
+	cfg.Models = append([]config.ModelConfig(nil), m.cfg.Models...)
+	for i := range cfg.Models {
+		if cfg.Models[i].Name == modelName {
+			cfg.Models[i].ModelPath = path
+		}
+	}
+	m.cfg = &cfg
+}
+
+// replaceBackend starts a successor for old, swaps it into mb once ready, then
+// drains and stops old.
+func (m *Manager) replaceBackend(ctx context.Context, mb *modelBackends, old *Backend, modelCfg config.ModelConfig) error {
+	m.mu.Lock()
+	nb := &Backend{
+		Model:       modelCfg,
+		State:       StateStarting,
+		LastUsed:    time.Now(),
+		instanceIdx: old.instanceIdx,
+	}
+	err := m.allocPort(nb)
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("replacement for instance %d: %w", old.instanceIdx, err)
+	}
+
+	if err := m.startBackend(nb); err != nil {
+		m.mu.Lock()
+		m.stopBackend(nb)
+		m.mu.Unlock()
+		return fmt.Errorf("starting replacement for instance %d: %w", old.instanceIdx, err)
+	}
+	if _, err := m.waitForReady(ctx, nb); err != nil {
+		m.mu.Lock()
+		m.stopBackend(nb)
+		m.mu.Unlock()
+		return fmt.Errorf("replacement for instance %d not ready: %w", old.instanceIdx, err)
+	}
+
+	m.mu.Lock()
+	swapped := false
+	if m.backends[modelCfg.Name] == mb {
+		for i, b := range mb.backends {
+			if b == old {
+				mb.backends[i] = nb
+				swapped = true
+				break
+			}
+		}
+	}
+	if !swapped {
+		// The model was unloaded or restarted concurrently
+		m.stopBackend(nb)
+		m.mu.Unlock()
+		return fmt.Errorf("instance %d was removed during restart", old.instanceIdx)
+	}
+	m.mu.Unlock()
+
+	log.Printf("[process] %s (instance %d) now served on port %d, draining port %d",
+		modelCfg.Name, old.instanceIdx, nb.Port, old.Port)
+	m.drainAndStop(old)
+	return nil
+}
+
+// drainAndStop waits for in-flight requests on b to finish (up to
+// drainTimeout) and then stops it. b must no longer be routable; callers
+// count a request only after EnsureModel returns, so the first check waits
+// drainGrace for requests that picked b just before.
+func (m *Manager) drainAndStop(b *Backend) {
+	deadline := time.Now().Add(drainTimeout)
+	time.Sleep(drainGrace)
+	for b.GetActiveReqs() > 0 && time.Now().Before(deadline) {
+		time.Sleep(500 * time.Millisecond)
+	}
+	if n := b.GetActiveReqs(); n > 0 {
+		log.Printf("[process] %s (instance %d) still has %d in-flight requests after %v, stopping anyway",
+			b.Model.Name, b.instanceIdx, n, drainTimeout)
+	}
+	m.mu.Lock()
+	if b.State != StateStopped { // not already stopped by an unload or reload
+		m.stopBackend(b)
+	}
+	m.mu.Unlock()
+}
+
+// DrainModel stops routing new requests to a loaded model and stops each of
+// its instances once its in-flight requests have finished, or after
+// drainTimeout. Until then, requests for the model fail with ErrModelDraining;
+// afterwards the model loads again on demand.
+func (m *Manager) DrainModel(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mb, ok := m.backends[name]
+	if !ok {
+		return fmt.Errorf("model %q is not loaded", name)
+	}
+
+	var draining []*Backend
+	for _, b := range mb.backends {
+		if b.State == StateReady || b.State == StateStarting {
+			b.State = StateDraining
+			draining = append(draining, b)
+		}
+	}
+	if len(draining) == 0 {
+		return fmt.Errorf("model %q has no running instances", name)
+	}
+	log.Printf("[process] Draining %s (%d instance(s))", name, len(draining))
+
+	for _, b := range draining {
+		go func(b *Backend) {
+			m.drainAndStop(b)
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			log.Printf("[process] %s (instance %d) drained and stopped", name, b.instanceIdx)
+			if m.backends[name] == mb && !m.anyRunning(mb) {
+				delete(m.backends, name)
+			}
+		}(b)
+	}
+	return nil
+}
+
+// anyRunning reports whether any of the model's backends is still starting,
+// serving or draining. Must be called with m.mu held.
+func (m *Manager) anyRunning(mb *modelBackends) bool {
+	for _, b := range mb.backends {
+		if b.State == StateReady || b.State == StateStarting || b.State == StateDraining {
+			return true
+		}
+	}
+	return false
+}
+
 // --- Listing ---
 
 // ListLoaded returns the names of currently loaded models.
@@ -508,6 +1375,49 @@ func (m *Manager) ListLoaded() []string {
 	return names
 }
 
+// ListDraining returns the names of models being drained.
+func (m *Manager) ListDraining() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for name, mb := range m.backends {
+		for _, b := range mb.backends {
+			if b.State == StateDraining {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// ModelReady reports whether the model has at least one ready backend.
+func (m *Manager) ModelReady(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if mb, ok := m.backends[name]; ok {
+		return len(m.getReadyBackends(mb)) > 0
+	}
+	return false
+}
+
+// AllFailed reports whether backends exist and every one of them has failed.
+func (m *Manager) AllFailed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	total := 0
+	for _, mb := range m.backends {
+		for _, b := range mb.backends {
+			if b.State != StateFailed {
+				return false
+			}
+			total++
+		}
+	}
+	return total > 0
+}
+
 // ListConfiguredModels returns all model configs.
 func (m *Manager) ListConfiguredModels() []config.ModelConfig {
 	m.mu.Lock()
@@ -558,92 +1468,267 @@ func (m *Manager) HealthCheck(ctx context.Context, intervalSec int) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			type healthTarget struct {
-				name        string
-				instanceIdx int
-				port        int
-				healthURL   string
-				backend     *Backend
-			}
-			var targets []healthTarget
+			m.checkHealth(ctx)
+		}
+	}
+}
 
-			m.mu.Lock()
-			for name, mb := range m.backends {
-				for _, b := range mb.backends {
-					if b.State != StateReady {
-						continue
-					}
-					targets = append(targets, healthTarget{
-						name:        name,
-						instanceIdx: b.instanceIdx,
-						port:        b.Port,
-						healthURL:   fmt.Sprintf("%s/health", b.URL()),
-						backend:     b,
-					})
-				}
-			}
-			m.mu.Unlock()
+// checkHealth probes every ready backend, and every failed external one so
+// it can recover, updating their state.
+func (m *Manager) checkHealth(ctx context.Context) {
+	type healthTarget struct {
+		name        string
+		instanceIdx int
+		port        int
+		backend     *Backend
+	}
+	var targets []healthTarget
 
-			for _, t := range targets {
-				resp, err := http.Get(t.healthURL)
-				ok := err == nil && resp != nil && resp.StatusCode == http.StatusOK
-				if resp != nil {
-					resp.Body.Close()
-				}
-				if !ok {
-					log.Printf("[health] %s (instance %d) failed health check, marking as failed",
-						t.name, t.instanceIdx)
-					m.mu.Lock()
-					t.backend.State = StateFailed
-					m.mu.Unlock()
-				}
+	m.mu.Lock()
+	for name, mb := range m.backends {
+		for _, b := range mb.backends {
+			// Failed external backends are probed so they can recover
+			if b.State != StateReady && !(b.External() && b.State == StateFailed) {
+				continue
 			}
+			targets = append(targets, healthTarget{
+				name:        name,
+				instanceIdx: b.instanceIdx,
+				port:        b.Port,
+				backend:     b,
+			})
 		}
 	}
+	m.mu.Unlock()
+
+	for _, t := range targets {
+		probeCtx, cancel := context.WithTimeout(ctx, healthTimeout)
+		resp, err := t.backend.probe(probeCtx, "/health")
+		if err == errInternalDeferred {
+			cancel()
+			continue
+		}
+		ok := err == nil && resp != nil && resp.StatusCode == http.StatusOK
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+		m.mu.Lock()
+		switch {
+		case !ok && t.backend.State == StateReady:
+			log.Printf("[health] %s (instance %d) failed health check, marking as failed",
+				t.name, t.instanceIdx)
+			t.backend.State = StateFailed
+		case ok && t.backend.State == StateFailed:
+			log.Printf("[health] %s (instance %d) external backend %s recovered",
+				t.name, t.instanceIdx, t.backend.URL())
+			t.backend.State = StateReady
+		}
+		m.mu.Unlock()
+	}
 }
 
-// --- Auto Download ---
+// --- Idle Unload ---
+
+// IdleUnloader periodically stops models that have been unused for longer
+// than their idle_unload_min. Thresholds are read from the current config on
+// every tick, so hot reload applies without a restart.
+func (m *Manager) IdleUnloader(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
 
-func (m *Manager) autoDownloadModel(modelCfg *config.ModelConfig) error {
-	ad := modelCfg.AutoDownload
-	if ad == nil {
-		return fmt.Errorf("no auto_download config")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.unloadIdle(time.Now())
+		}
 	}
+}
 
-	localDir := ad.LocalDir
-	if localDir == "" {
-		localDir = filepath.Join(os.Getenv("HOME"), "models")
+func (m *Manager) unloadIdle(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.cfg.Models {
+		mc := &m.cfg.Models[i]
+		idleAfter := m.cfg.IdleUnloadAfter(mc)
+		if idleAfter == 0 || mc.Pinned || mc.IsExternal() {
+			continue
+		}
+		mb, ok := m.backends[mc.Name]
+		if !ok {
+			continue
+		}
+
+		idle := true
+		var lastUsed time.Time
+		for _, b := range mb.backends {
+			if b.State == StateStarting || b.GetActiveReqs() > 0 || now.Sub(b.LastUsed) < idleAfter {
+				idle = false
+				break
+			}
+			if b.LastUsed.After(lastUsed) {
+				lastUsed = b.LastUsed
+			}
+		}
+		if !idle {
+			continue
+		}
+
+		log.Printf("[process] idle_evicted: %s unused since %s (threshold %v)",
+			mc.Name, lastUsed.Format(time.RFC3339), idleAfter)
+		m.stopModel(mc.Name)
 	}
+}
 
-	destPath := filepath.Join(localDir, ad.File)
+// --- Dynamic Scaling ---
 
-	if _, err := os.Stat(destPath); err == nil {
-		log.Printf("[download] %s already exists at %s", ad.File, destPath)
-		modelCfg.ModelPath = destPath
-		return nil
+const (
+	scaleInterval  = 5 * time.Second
+	scaleUpSamples = 3 // consecutive busy samples before adding an instance
+)
+
+// Autoscale adds and removes instances of models configured with
+// max_instances > instances, based on sampled in-flight requests.
+func (m *Manager) Autoscale(ctx context.Context) {
+	ticker := time.NewTicker(scaleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.evaluateScaling(time.Now())
+		}
+	}
+}
+
+func (m *Manager) evaluateScaling(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, mb := range m.backends {
+		mc := m.modelConfig(name)
+		if mc == nil || mc.IsExternal() || mc.MaxInstances <= mc.MinInstances || mb.scaling {
+			continue
+		}
+
+		ready := m.getReadyBackends(mb)
+		if len(ready) == 0 {
+			continue
+		}
+		var active int64
+		for _, b := range ready {
+			active += b.GetActiveReqs()
+		}
+		if active > 0 {
+			mb.lastBusy = now
+		}
+
+		if active >= int64(mc.ScaleUpActiveReqs*len(ready)) {
+			mb.busySamples++
+		} else {
+			mb.busySamples = 0
+		}
+
+		switch {
+		case mb.busySamples >= scaleUpSamples && len(mb.backends) < mc.MaxInstances:
+			if m.loadedCount() >= m.maxLoaded {
+				continue
+			}
+			mb.busySamples = 0
+			mb.scaling = true
+			go m.scaleUp(mb, *mc, float64(active)/float64(len(ready)))
+
+		case len(mb.backends) > mc.MinInstances && active == 0 &&
+			now.Sub(mb.lastBusy) >= time.Duration(mc.ScaleDownIdleSec)*time.Second &&
+			now.Sub(mb.lastScaled) >= time.Duration(mc.ScaleDownIdleSec)*time.Second:
+			victim := ready[0]
+			for _, b := range ready {
+				if b.instanceIdx > victim.instanceIdx {
+					victim = b
+				}
+			}
+			m.removeBackend(mb, victim)
+			mb.lastScaled = now
+			log.Printf("[process] scale_down: %s instance %d (port %d), %d -> %d instances",
+				name, victim.instanceIdx, victim.Port, len(mb.backends)+1, len(mb.backends))
+			go m.drainAndStop(victim)
+		}
 	}
+}
 
-	if err := os.MkdirAll(localDir, 0755); err != nil {
-		return fmt.Errorf("creating dir %s: %w", localDir, err)
+// scaleUp starts one more instance of the model and waits for it to be ready.
+func (m *Manager) scaleUp(mb *modelBackends, modelCfg config.ModelConfig, avgActive float64) {
+	m.mu.Lock()
+	idx := 0
+	for _, b := range mb.backends {
+		if b.instanceIdx >= idx {
+			idx = b.instanceIdx + 1
+		}
 	}
+	nb := &Backend{
+		Model:       modelCfg,
+		State:       StateStarting,
+		LastUsed:    time.Now(),
+		instanceIdx: idx,
+	}
+	if err := m.allocPort(nb); err != nil {
+		log.Printf("[process] scale_up of %s skipped: %v", modelCfg.Name, err)
+		mb.scaling = false
+		m.mu.Unlock()
+		return
+	}
+	mb.backends = append(mb.backends, nb)
+	log.Printf("[process] scale_up: %s instance %d on port %d (avg %.1f active/instance), %d -> %d instances",
+		modelCfg.Name, idx, nb.Port, avgActive, len(mb.backends)-1, len(mb.backends))
+	m.mu.Unlock()
 
-	log.Printf("[download] Downloading %s/%s to %s...", ad.Repo, ad.File, destPath)
+	err := m.startBackend(nb)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), modelCfg.StartupTimeout())
+		_, err = m.waitForReady(ctx, nb)
+		cancel()
+	}
 
-	cmd := exec.Command("huggingface-cli", "download", ad.Repo, ad.File, "--local-dir", localDir)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		url := fmt.Sprintf("https://huggingface.co/%s/resolve/main/%s", ad.Repo, ad.File)
-		log.Printf("[download] huggingface-cli failed, trying curl: %s", url)
-		cmd = exec.Command("curl", "-L", "-o", destPath, url)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("download failed: %w", err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mb.scaling = false
+	mb.lastScaled = time.Now()
+	if err != nil {
+		log.Printf("[process] scale_up of %s failed: %v", modelCfg.Name, err)
+		m.removeBackend(mb, nb)
+		m.stopBackend(nb)
+	}
+}
+
+// removeBackend takes b out of rotation. Must be called with m.mu held.
+func (m *Manager) removeBackend(mb *modelBackends, b *Backend) {
+	for i, cur := range mb.backends {
+		if cur == b {
+			mb.backends = append(mb.backends[:i], mb.backends[i+1:]...)
+			return
 		}
 	}
+}
 
-	modelCfg.ModelPath = destPath
-	log.Printf("[download] Downloaded %s successfully", ad.File)
-	return nil
+// loadedCount returns the number of ready or starting local backends.
+// External backends use no local resources and do not count against
+// max_loaded_models. Must be called with m.mu held.
+func (m *Manager) loadedCount() int {
+	loaded := 0
+	for _, mb := range m.backends {
+		for _, b := range mb.backends {
+			if b.External() {
+				continue
+			}
+			if b.State == StateReady || b.State == StateStarting || b.State == StateDraining {
+				loaded++
+			}
+		}
+	}
+	return loaded
 }
@@ -0,0 +1,525 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/llamawrapper/gateway/internal/config"
+)
+
+func TestReleaseBackendRefreshesLastUsed(t *testing.T) {
+	tests := []struct {
+		name       string
+		sinceStart time.Duration // how long the request ran
+		idleAfter  time.Duration // time from release to the idle check
+		wantLoaded bool
+	}{
+		{name: "long request just finished", sinceStart: 2 * time.Hour, idleAfter: time.Minute, wantLoaded: true},
+		{name: "idle since the request finished", sinceStart: 2 * time.Hour, idleAfter: 10 * time.Minute, wantLoaded: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Models: []config.ModelConfig{{Name: "m", IdleUnloadMin: 5}}}
+			m := NewManager(cfg)
+			b := &Backend{Model: cfg.Models[0], State: StateReady, LastUsed: time.Now().Add(-tt.sinceStart)}
+			m.backends["m"] = &modelBackends{backends: []*Backend{b}}
+
+			b.IncrActiveReqs()
+			m.ReleaseBackend(b)
+			if n := b.GetActiveReqs(); n != 0 {
+				t.Fatalf("ActiveReqs = %d after release, want 0", n)
+			}
+
+			m.unloadIdle(time.Now().Add(tt.idleAfter))
+			if _, loaded := m.backends["m"]; loaded != tt.wantLoaded {
+				t.Errorf("loaded = %v, want %v", loaded, tt.wantLoaded)
+			}
+		})
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{0, 2 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{5, 32 * time.Second},
+		{6, maxRestartBackoff},
+		{100, maxRestartBackoff},
+	}
+	for _, tt := range tests {
+		if got := restartBackoff(tt.n); got != tt.want {
+			t.Errorf("restartBackoff(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestCrashLoopGivesUp(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for a restart backoff")
+	}
+	cfg := &config.Config{
+		LlamaServerPath: "/bin/false", // exits 1 immediately
+		PortRangeStart:  19300,
+		PortRangeEnd:    19399,
+		MaxLoadedModels: 1,
+		MaxRestarts:     1,
+		Models:          []config.ModelConfig{{Name: "m", ModelPath: "m.gguf", Instances: 1, StartupTimeoutSec: 10}},
+	}
+	m := NewManager(cfg)
+	defer m.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := m.EnsureModel(ctx, "m"); err == nil {
+		t.Fatal("EnsureModel succeeded for a backend that cannot start")
+	}
+
+	// One restart after restartBackoff(1), then the second crash is terminal
+	deadline := time.Now().Add(restartBackoff(1) + 5*time.Second)
+	for {
+		m.mu.Lock()
+		var looped bool
+		var restarts int
+		if mb, ok := m.backends["m"]; ok && len(mb.backends) > 0 {
+			looped, restarts = mb.backends[0].crashLooped, mb.backends[0].restartCount
+		}
+		m.mu.Unlock()
+		if looped {
+			if restarts != cfg.MaxRestarts+1 {
+				t.Errorf("restartCount = %d, want %d", restarts, cfg.MaxRestarts+1)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("backend never marked as crash-looping")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	_, err := m.EnsureModel(context.Background(), "m")
+	if err == nil || !strings.Contains(err.Error(), "crash-looping") {
+		t.Errorf("EnsureModel after crash loop = %v, want crash-looping error", err)
+	}
+}
+
+// freePort returns a port that nothing was listening on a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestAllocPort(t *testing.T) {
+	newManager := func(start, end int) *Manager {
+		return NewManager(&config.Config{PortRangeStart: start, PortRangeEnd: end})
+	}
+
+	t.Run("freed port reused", func(t *testing.T) {
+		base := freePort(t)
+		m := newManager(base, base+10)
+		b1, b2, b3 := &Backend{}, &Backend{}, &Backend{}
+		if err := m.allocPort(b1); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.allocPort(b2); err != nil {
+			t.Fatal(err)
+		}
+		if b1.Port == b2.Port {
+			t.Fatalf("two backends share port %d", b1.Port)
+		}
+		m.releasePort(b1)
+		if err := m.allocPort(b3); err != nil {
+			t.Fatal(err)
+		}
+		if b3.Port != b1.Port {
+			t.Errorf("got port %d after unload, want freed port %d", b3.Port, b1.Port)
+		}
+	})
+
+	t.Run("occupied port skipped", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		busy := ln.Addr().(*net.TCPAddr).Port
+		m := newManager(busy, busy+10)
+		b := &Backend{}
+		if err := m.allocPort(b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Port == busy {
+			t.Errorf("allocated port %d, which is in use", busy)
+		}
+	})
+
+	t.Run("range exhausted", func(t *testing.T) {
+		base := freePort(t)
+		m := newManager(base, base)
+		if err := m.allocPort(&Backend{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.allocPort(&Backend{}); err == nil {
+			t.Error("allocated a port beyond port_range_end")
+		}
+	})
+}
+
+func TestExternalBackends(t *testing.T) {
+	var hits [2]atomic.Int64
+	var unhealthy [2]atomic.Bool
+	var urls []string
+	for i := range hits {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" {
+				if unhealthy[i].Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+				return
+			}
+			hits[i].Add(1)
+		}))
+		defer srv.Close()
+		urls = append(urls, srv.URL)
+	}
+	m := NewManager(&config.Config{Models: []config.ModelConfig{{Name: "m", ExternalURLs: urls}}})
+
+	// send routes n requests and returns how many each server received
+	send := func(t *testing.T, n int) [2]int64 {
+		t.Helper()
+		before := [2]int64{hits[0].Load(), hits[1].Load()}
+		for i := 0; i < n; i++ {
+			b, err := m.EnsureModel(context.Background(), "m")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.Get(b.URL() + "/v1/models")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+		return [2]int64{hits[0].Load() - before[0], hits[1].Load() - before[1]}
+	}
+
+	if got := send(t, 4); got != [2]int64{2, 2} {
+		t.Errorf("hits = %v, want requests spread round-robin [2 2]", got)
+	}
+
+	unhealthy[1].Store(true)
+	m.checkHealth(context.Background())
+	if got := send(t, 4); got != [2]int64{4, 0} {
+		t.Errorf("hits with backend 1 failing = %v, want [4 0]", got)
+	}
+
+	unhealthy[0].Store(true)
+	m.checkHealth(context.Background())
+	if _, err := m.EnsureModel(context.Background(), "m"); !errors.Is(err, ErrBackendsUnhealthy) {
+		t.Errorf("EnsureModel with every backend failing: err = %v, want ErrBackendsUnhealthy", err)
+	}
+
+	unhealthy[1].Store(false)
+	m.checkHealth(context.Background())
+	if got := send(t, 2); got != [2]int64{0, 2} {
+		t.Errorf("hits after backend 1 recovered = %v, want [0 2]", got)
+	}
+
+	m.Shutdown()
+	for _, u := range urls {
+		resp, err := http.Get(u + "/health")
+		if err != nil {
+			t.Fatalf("external backend %s gone after Shutdown: %v", u, err)
+		}
+		resp.Body.Close()
+	}
+}
+
+func TestWaitForReady(t *testing.T) {
+	tests := []struct {
+		name          string
+		healthyAfter  time.Duration // when the fake backend starts answering 200
+		timeoutSec    int
+		readinessPath string
+		wantErr       error
+	}{
+		{name: "ready before deadline", healthyAfter: time.Second, timeoutSec: 5, readinessPath: "/health"},
+		{name: "custom readiness path", healthyAfter: time.Second, timeoutSec: 5, readinessPath: "/ready"},
+		{name: "deadline passes first", healthyAfter: time.Hour, timeoutSec: 1, readinessPath: "/health",
+			wantErr: ErrStartupTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := time.Now()
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.readinessPath || time.Since(started) < tt.healthyAfter {
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}))
+			defer srv.Close()
+			port := srv.Listener.Addr().(*net.TCPAddr).Port
+
+			m := NewManager(&config.Config{})
+			b := &Backend{
+				Model: config.ModelConfig{Name: "m", StartupTimeoutSec: tt.timeoutSec, ReadinessPath: tt.readinessPath},
+				State: StateStarting,
+				Port:  port,
+			}
+			b.startedAt = started
+
+			got, err := m.waitForReady(context.Background(), b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if b.State != StateFailed {
+					t.Errorf("State = %v after timeout, want failed", b.State)
+				}
+				return
+			}
+			if got != b || b.State != StateReady {
+				t.Errorf("got %p in state %v, want %p ready", got, b.State, b)
+			}
+		})
+	}
+}
+
+func TestInternalRequests(t *testing.T) {
+	var internal atomic.Int64 // requests seen with InternalHeader
+	arrived, unblock := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(InternalHeader) != "" {
+			internal.Add(1)
+		}
+		switch r.URL.Path {
+		case "/slow":
+			arrived <- struct{}{}
+			<-unblock
+		case "/health":
+			w.WriteHeader(http.StatusInternalServerError) // wedged
+		}
+	}))
+	defer srv.Close()
+
+	b := &Backend{Model: config.ModelConfig{Name: "m", ParallelSlots: 4}, State: StateReady, externalURL: srv.URL}
+	send := func(probe bool) error {
+		var resp *http.Response
+		var err error
+		if probe {
+			resp, err = b.probe(context.Background(), "/")
+		} else {
+			resp, err = b.internalRequest(context.Background(), http.MethodGet, "/", nil)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	tests := []struct {
+		name         string
+		activeReqs   int64
+		probe        bool
+		wantDeferred bool
+	}{
+		{name: "idle", activeReqs: 0},
+		{name: "below threshold", activeReqs: 2},
+		{name: "last free slot", activeReqs: 3, wantDeferred: true},
+		{name: "all slots busy", activeReqs: 4, wantDeferred: true},
+		{name: "probe under load", activeReqs: 4, probe: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt64(&b.ActiveReqs, tt.activeReqs)
+			before := internal.Load()
+			err := send(tt.probe)
+			if deferred := errors.Is(err, errInternalDeferred); deferred != tt.wantDeferred {
+				t.Fatalf("err = %v, want deferred %v", err, tt.wantDeferred)
+			}
+			if want := before + 1; !tt.wantDeferred && internal.Load() != want {
+				t.Errorf("backend saw %d internal requests, want %d", internal.Load(), want)
+			}
+		})
+	}
+
+	t.Run("one internal call at a time", func(t *testing.T) {
+		atomic.StoreInt64(&b.ActiveReqs, 0)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if resp, err := b.probe(context.Background(), "/slow"); err == nil {
+				resp.Body.Close()
+			}
+		}()
+		<-arrived
+		for _, probe := range []bool{false, true} {
+			if err := send(probe); !errors.Is(err, errInternalDeferred) {
+				t.Errorf("probe=%v while another call is running: err = %v, want deferred", probe, err)
+			}
+		}
+		close(unblock)
+		<-done
+	})
+
+	t.Run("wedged busy backend fails its health check", func(t *testing.T) {
+		atomic.StoreInt64(&b.ActiveReqs, 4)
+		m := NewManager(&config.Config{})
+		m.backends["m"] = &modelBackends{backends: []*Backend{b}}
+		m.checkHealth(context.Background())
+		if b.State != StateFailed {
+			t.Errorf("State = %v, want failed", b.State)
+		}
+	})
+}
+
+func TestDrainModel(t *testing.T) {
+	m := NewManager(fakeServerConfig(t, "", ""))
+	t.Cleanup(m.Shutdown)
+
+	b, err := m.EnsureModel(context.Background(), "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- fakeChat(m, b, time.Second) }()
+	for b.GetActiveReqs() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := m.DrainModel("m"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.EnsureModel(context.Background(), "m"); !errors.Is(err, ErrModelDraining) {
+		t.Errorf("EnsureModel while draining: err = %v, want ErrModelDraining", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("in-flight request failed: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		state, registered := b.State, m.backends["m"] != nil
+		m.mu.Unlock()
+		if state == StateStopped && !registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("after drain: state = %v, model registered = %v; want stopped and removed", state, registered)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestEvaluateScaling(t *testing.T) {
+	cfg := fakeServerConfig(t, "", "    max_instances: 2\n    scale_up_active_reqs: 1\n    scale_down_idle_sec: 1\n")
+	m := NewManager(cfg)
+	t.Cleanup(m.Shutdown)
+
+	first, err := m.EnsureModel(context.Background(), "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	instances := func() []*Backend {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return append([]*Backend(nil), m.backends["m"].backends...)
+	}
+
+	// Scale up only after scaleUpSamples busy samples in a row
+	first.IncrActiveReqs()
+	now := time.Now()
+	for i := 1; i < scaleUpSamples; i++ {
+		m.evaluateScaling(now)
+		if n := len(instances()); n != 1 {
+			t.Fatalf("%d instances after %d busy sample(s), want 1", n, i)
+		}
+	}
+	m.evaluateScaling(now)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		m.mu.Lock()
+		scaling := m.backends["m"].scaling
+		m.mu.Unlock()
+		if !scaling {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scale-up did not finish")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	m.ReleaseBackend(first)
+
+	all := instances()
+	if len(all) != 2 {
+		t.Fatalf("%d instances after scale-up, want 2", len(all))
+	}
+	added := all[1]
+	m.mu.Lock()
+	addedState, owner := added.State, m.ports[added.Port]
+	m.mu.Unlock()
+	if addedState != StateReady || added.instanceIdx != 1 {
+		t.Errorf("new instance: state %v, index %d; want ready, 1", addedState, added.instanceIdx)
+	}
+	if added.Port == first.Port || added.Port < cfg.PortRangeStart || added.Port > cfg.PortRangeEnd || owner != added {
+		t.Errorf("new instance port %d (first on %d, range %d-%d, owner %p), want a free port in range held by it",
+			added.Port, first.Port, cfg.PortRangeStart, cfg.PortRangeEnd, owner)
+	}
+	if err := fakeChat(m, added, 0); err != nil {
+		t.Errorf("request to the new instance: %v", err)
+	}
+
+	// No scale-down while a request is in flight, however long it runs
+	later := time.Now().Add(time.Minute)
+	first.IncrActiveReqs()
+	m.evaluateScaling(later)
+	if n := len(instances()); n != 2 {
+		t.Fatalf("%d instances after an evaluation with a request in flight, want 2", n)
+	}
+	m.ReleaseBackend(first)
+
+	// Once idle, the newest instance leaves rotation but a request that
+	// picked it just before is still answered
+	m.evaluateScaling(later.Add(time.Minute))
+	if got := instances(); len(got) != 1 || got[0] != first {
+		t.Fatalf("instances after scale-down = %d, want only the first", len(got))
+	}
+	if err := fakeChat(m, added, time.Second); err != nil {
+		t.Errorf("in-flight request on the removed instance: %v", err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		m.mu.Lock()
+		state := added.State
+		m.mu.Unlock()
+		if state == StateStopped {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("removed instance state = %v, want stopped", state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	b, err := m.EnsureModel(context.Background(), "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != first {
+		t.Errorf("EnsureModel after scale-down picked port %d, want the first instance on %d", b.Port, first.Port)
+	}
+}
@@ -0,0 +1,16 @@
+package process
+
+import "context"
+
+type queueIDKey struct{}
+
+// WithQueueID tags ctx so that a request queued by EnsureModel carries id,
+// letting the client look up its position with QueuePosition.
+func WithQueueID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, queueIDKey{}, id)
+}
+
+func queueIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(queueIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,149 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessStats is the CPU and memory use of one llama-server process.
+type ProcessStats struct {
+	Model      string  `json:"model"`
+	Instance   int     `json:"instance"`
+	PID        int     `json:"pid"`
+	CPUPercent float64 `json:"cpu_percent"` // of one core, since the previous call
+	RSSMB      float64 `json:"rss_mb"`
+}
+
+// clockTicks is USER_HZ, which is 100 on every mainstream Linux platform.
+const clockTicks = 100
+
+// cpuSample is a process's cumulative CPU time at a point in time.
+type cpuSample struct {
+	cpu time.Duration
+	at  time.Time
+}
+
+// GetProcessStats returns CPU and RSS for every running local backend. It
+// reads /proc on Linux and falls back to ps elsewhere. CPU is averaged since
+// the previous call (or since the process started, on the first call).
+func (m *Manager) GetProcessStats() []ProcessStats {
+	type target struct {
+		model    string
+		instance int
+		pid      int
+		started  time.Time
+	}
+	var targets []target
+
+	m.mu.Lock()
+	for name, mb := range m.backends {
+		for _, b := range mb.backends {
+			if b.Process == nil || b.Process.Process == nil {
+				continue
+			}
+			targets = append(targets, target{name, b.instanceIdx, b.Process.Process.Pid, b.startedAt})
+		}
+	}
+	m.mu.Unlock()
+
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	if m.cpuSamples == nil {
+		m.cpuSamples = make(map[int]cpuSample)
+	}
+
+	var stats []ProcessStats
+	seen := make(map[int]bool, len(targets))
+	for _, t := range targets {
+		st := ProcessStats{Model: t.model, Instance: t.instance, PID: t.pid}
+		now := time.Now()
+		if runtime.GOOS == "linux" {
+			cpu, rss, err := procStats(t.pid)
+			if err != nil {
+				continue
+			}
+			st.RSSMB = rss
+			prev, ok := m.cpuSamples[t.pid]
+			if !ok {
+				prev = cpuSample{at: t.started}
+			}
+			if elapsed := now.Sub(prev.at); elapsed > 0 {
+				st.CPUPercent = float64(cpu-prev.cpu) / float64(elapsed) * 100
+			}
+			m.cpuSamples[t.pid] = cpuSample{cpu: cpu, at: now}
+		} else {
+			cpu, rss, err := psStats(t.pid)
+			if err != nil {
+				continue
+			}
+			st.CPUPercent, st.RSSMB = cpu, rss
+		}
+		seen[t.pid] = true
+		stats = append(stats, st)
+	}
+	for pid := range m.cpuSamples {
+		if !seen[pid] {
+			delete(m.cpuSamples, pid)
+		}
+	}
+	return stats
+}
+
+// procRoot is where procStats looks for /proc; tests point it at fixtures.
+var procRoot = "/proc"
+
+// procStats reads cumulative CPU time from /proc/<pid>/stat and resident
+// memory from /proc/<pid>/status.
+func procStats(pid int) (time.Duration, float64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("%s/%d/stat", procRoot, pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	// The command name may contain spaces; fields resume after its ')'
+	s := string(data)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected /proc/%d/stat format", pid)
+	}
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	cpu := time.Duration(utime+stime) * time.Second / clockTicks
+
+	f, err := os.Open(fmt.Sprintf("%s/%d/status", procRoot, pid))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	var rssKB float64
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if line := sc.Text(); strings.HasPrefix(line, "VmRSS:") {
+			if parts := strings.Fields(line); len(parts) >= 2 {
+				rssKB, _ = strconv.ParseFloat(parts[1], 64)
+			}
+			break
+		}
+	}
+	return cpu, rssKB / 1024, nil
+}
+
+// psStats asks ps for CPU percent and RSS, for platforms without /proc.
+func psStats(pid int) (float64, float64, error) {
+	out, err := exec.Command("ps", "-o", "pcpu=,rss=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	fields := strings.Fields(string(out))
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("unexpected ps output for pid %d", pid)
+	}
+	cpu, _ := strconv.ParseFloat(fields[0], 64)
+	rssKB, _ := strconv.ParseFloat(fields[1], 64)
+	return cpu, rssKB / 1024, nil
+}
@@ -0,0 +1,41 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProcStats(t *testing.T) {
+	defer func(root string) { procRoot = root }(procRoot)
+	procRoot = "testdata/proc"
+
+	tests := []struct {
+		name    string
+		pid     int
+		cpu     time.Duration
+		rssMB   float64
+		wantErr bool
+	}{
+		{name: "llama-server", pid: 100, cpu: 20 * time.Second, rssMB: 2048},
+		{name: "command with spaces and parens", pid: 200, cpu: time.Second, rssMB: 0.5},
+		{name: "truncated stat", pid: 300, wantErr: true},
+		{name: "no such process", pid: 400, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpu, rss, err := procStats(tt.pid)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("procStats(%d) succeeded, want error", tt.pid)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("procStats(%d): %v", tt.pid, err)
+			}
+			if cpu != tt.cpu || rss != tt.rssMB {
+				t.Errorf("procStats(%d) = %v, %v MB; want %v, %v MB", tt.pid, cpu, rss, tt.cpu, tt.rssMB)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	warmupPromptTimeout = 5 * time.Minute
+	warmupRetryDelay    = 2 * time.Second
+	warmupMaxDeferrals  = 30 // about a minute of busy backend per prompt
+)
+
+// warmup sends each prompt to a freshly ready backend as a one-token chat
+// completion, so llama-server caches the prompt prefix before real requests
+// with the same system prompt arrive. It yields to client traffic and stops
+// early if the backend goes away.
+func (m *Manager) warmup(b *Backend, prompts []string) {
+	name := b.Model.Name
+	log.Printf("[process] warmup_started: %s (instance %d), %d prompt(s)", name, b.instanceIdx, len(prompts))
+	start := time.Now()
+	warmed := 0
+
+	for i, prompt := range prompts {
+		body, _ := json.Marshal(map[string]interface{}{
+			"messages":     []map[string]string{{"role": "system", "content": prompt}},
+			"max_tokens":   1,
+			"cache_prompt": true,
+		})
+
+		var err error
+		for attempt := 0; ; attempt++ {
+			if !m.backendReady(b) {
+				log.Printf("[process] warmup_aborted: %s (instance %d) is no longer ready", name, b.instanceIdx)
+				return
+			}
+			err = m.warmupPrompt(b, body)
+			if !errors.Is(err, errInternalDeferred) || attempt >= warmupMaxDeferrals {
+				break
+			}
+			time.Sleep(warmupRetryDelay)
+		}
+		if err != nil {
+			log.Printf("[process] warmup %s (instance %d): prompt %d/%d failed: %v", name, b.instanceIdx, i+1, len(prompts), err)
+			continue
+		}
+		warmed++
+		log.Printf("[process] warmup %s (instance %d): prompt %d/%d cached", name, b.instanceIdx, i+1, len(prompts))
+	}
+
+	log.Printf("[process] warmup_complete: %s (instance %d), %d/%d prompt(s) in %v",
+		name, b.instanceIdx, warmed, len(prompts), time.Since(start).Round(time.Millisecond))
+}
+
+func (m *Manager) warmupPrompt(b *Backend, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupPromptTimeout)
+	defer cancel()
+
+	resp, err := b.internalRequest(ctx, http.MethodPost, "/v1/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// backendReady reports whether b is still serving.
+func (m *Manager) backendReady(b *Backend) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return b.State == StateReady
+}
@@ -0,0 +1,110 @@
+package process
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+const watchInterval = 10 * time.Second
+
+// fileStamp identifies a version of a model file on disk.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchedFile tracks a model file for watch_file. A change is acted on only
+// once the file has looked the same for two polls, so a copy in progress is
+// not loaded half-written.
+type watchedFile struct {
+	path    string
+	loaded  fileStamp // version the running instances were started from
+	pending *fileStamp
+}
+
+// ReloadModel replaces every loaded instance of a model with a fresh one
+// started from the current config. New instances come up on new ports and
+// take over before the old ones are drained, so no requests are dropped.
+func (m *Manager) ReloadModel(ctx context.Context, modelName string) error {
+	log.Printf("[process] hot_swap: reloading %s", modelName)
+	if err := m.RollingRestart(ctx, modelName); err != nil {
+		log.Printf("[process] hot_swap: %s failed: %v", modelName, err)
+		return err
+	}
+	log.Printf("[process] hot_swap: %s complete", modelName)
+	return nil
+}
+
+// WatchModelFiles reloads loaded models with watch_file set when their GGUF
+// file changes on disk.
+func (m *Manager) WatchModelFiles(ctx context.Context) {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	watched := make(map[string]*watchedFile)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, name := range m.checkModelFiles(watched) {
+				go func(name string) {
+					rctx, cancel := context.WithTimeout(ctx, 15*time.Minute)
+					defer cancel()
+					m.ReloadModel(rctx, name)
+				}(name)
+			}
+		}
+	}
+}
+
+// checkModelFiles updates watched and returns the models whose file changed
+// and has settled.
+func (m *Manager) checkModelFiles(watched map[string]*watchedFile) []string {
+	m.mu.Lock()
+	paths := make(map[string]string)
+	for _, mc := range m.cfg.Models {
+		if !mc.WatchFile || mc.ModelPath == "" || mc.IsExternal() {
+			continue
+		}
+		if _, loaded := m.backends[mc.Name]; loaded {
+			paths[mc.Name] = mc.ModelPath
+		}
+	}
+	m.mu.Unlock()
+
+	for name := range watched {
+		if _, ok := paths[name]; !ok {
+			delete(watched, name) // unloaded: the next load reads the file afresh
+		}
+	}
+
+	var changed []string
+	for name, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue // may be mid-replace
+		}
+		cur := fileStamp{modTime: fi.ModTime(), size: fi.Size()}
+
+		w, ok := watched[name]
+		if !ok || w.path != path {
+			watched[name] = &watchedFile{path: path, loaded: cur}
+			continue
+		}
+		switch {
+		case cur == w.loaded:
+			w.pending = nil
+		case w.pending != nil && *w.pending == cur:
+			log.Printf("[process] %s changed on disk, reloading %s", path, name)
+			w.loaded = cur
+			w.pending = nil
+			changed = append(changed, name)
+		default:
+			w.pending = &cur
+		}
+	}
+	return changed
+}
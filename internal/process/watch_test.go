@@ -0,0 +1,70 @@
+package process
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReloadModelDropsNoRequests(t *testing.T) {
+	m := NewManager(fakeServerConfig(t, "", ""))
+	t.Cleanup(m.Shutdown)
+
+	old, err := m.EnsureModel(context.Background(), "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var served, failed atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				b, err := m.EnsureModel(context.Background(), "m")
+				if err == nil {
+					err = fakeChat(m, b, 50*time.Millisecond)
+				}
+				if err != nil {
+					t.Logf("request failed: %v", err)
+					failed.Add(1)
+					continue
+				}
+				served.Add(1)
+			}
+		}()
+	}
+
+	if err := m.ReloadModel(context.Background(), "m"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if n := failed.Load(); n > 0 {
+		t.Errorf("%d request(s) failed during the swap (%d served)", n, served.Load())
+	}
+	cur, err := m.EnsureModel(context.Background(), "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	oldState := old.State
+	m.mu.Unlock()
+	if cur == old || cur.Port == old.Port {
+		t.Errorf("still served by the old instance on port %d", old.Port)
+	}
+	if oldState != StateStopped {
+		t.Errorf("old instance state = %v, want stopped", oldState)
+	}
+}